@@ -0,0 +1,137 @@
+package apisixregistryagent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// tlsFileReloader 按文件修改时间缓存证书，文件轮换后在下一次握手时自动重新加载
+type tlsFileReloader struct {
+	spec *AdminTLSSpec
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	pool    *x509.CertPool
+	caMod   time.Time
+}
+
+func modTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *tlsFileReloader) certificate() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	mod, err := modTime(r.spec.CertFile, r.spec.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("admin tls client cert: %w", err)
+	}
+	if r.cert != nil && mod.Equal(r.certMod) {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.spec.CertFile, r.spec.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("admin tls client cert: %w", err)
+	}
+	if r.cert != nil {
+		log.Printf("[APISIX-AGENT] Admin API client certificate reloaded: %s", r.spec.CertFile)
+	}
+	r.cert, r.certMod = &cert, mod
+	return r.cert, nil
+}
+
+func (r *tlsFileReloader) rootCAs() (*x509.CertPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	mod, err := modTime(r.spec.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("admin tls ca: %w", err)
+	}
+	if r.pool != nil && mod.Equal(r.caMod) {
+		return r.pool, nil
+	}
+	data, err := os.ReadFile(r.spec.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("admin tls ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("admin tls ca: no certificates in %s", r.spec.CAFile)
+	}
+	if r.pool != nil {
+		log.Printf("[APISIX-AGENT] Admin API CA bundle reloaded: %s", r.spec.CAFile)
+	}
+	r.pool, r.caMod = pool, mod
+	return r.pool, nil
+}
+
+// verify 使用当前 CA 校验服务端证书链（代替静态 RootCAs 以支持 CA 轮换）
+func (r *tlsFileReloader) verify(cs tls.ConnectionState) error {
+	pool, err := r.rootCAs()
+	if err != nil {
+		return err
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("admin tls: no server certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, c := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err = cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// NewAdminTLSConfig 生成访问 Admin API 的 tls.Config。证书文件在握手时按修改时间重新加载；
+// 返回 error 表示首次加载失败（文件不可读、证书与私钥不匹配等），NewApisixClient 据此使启动失败
+func NewAdminTLSConfig(spec *AdminTLSSpec) (*tls.Config, error) {
+	r := &tlsFileReloader{spec: spec}
+	cfg := &tls.Config{ServerName: spec.ServerName, MinVersion: tls.VersionTLS12}
+	var errs []error
+	if spec.CertFile != "" || spec.KeyFile != "" {
+		if spec.CertFile == "" || spec.KeyFile == "" {
+			return nil, fmt.Errorf("admin tls: cert_file and key_file must be set together")
+		}
+		if _, err := r.certificate(); err != nil {
+			errs = append(errs, err)
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate()
+		}
+	}
+	if spec.InsecureSkipVerify {
+		log.Printf("[APISIX-AGENT][WARN] !!! admin_tls.insecure_skip_verify is enabled: the Admin API certificate is NOT verified and the admin key can be intercepted. Never use this in production !!!")
+		cfg.InsecureSkipVerify = true
+	} else if spec.CAFile != "" {
+		if _, err := r.rootCAs(); err != nil {
+			errs = append(errs, err)
+		}
+		// 关闭内置校验，由 VerifyConnection 使用可轮换的 CA 校验
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = r.verify
+	}
+	if len(errs) > 0 {
+		return cfg, errs[0]
+	}
+	return cfg, nil
+}
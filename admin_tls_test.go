@@ -0,0 +1,120 @@
+package apisixregistryagent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdminTLS_CAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caPath, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{AdminAPI: srv.URL, MaxRetry: 1, RetryInterval: time.Millisecond, AdminTLS: &AdminTLSSpec{CAFile: caPath}}
+	if err := NewApisixClient(cfg).DeleteRoute(context.Background(), "r1"); err != nil {
+		t.Errorf("expected request with private CA to succeed: %v", err)
+	}
+
+	cfg.AdminTLS = &AdminTLSSpec{CAFile: caPath, ServerName: "apisix.invalid"}
+	if err := NewApisixClient(cfg).DeleteRoute(context.Background(), "r1"); err == nil {
+		t.Errorf("expected server name mismatch to fail")
+	}
+
+	cfg.AdminTLS = nil
+	if err := NewApisixClient(cfg).DeleteRoute(context.Background(), "r1"); err == nil {
+		t.Errorf("expected unknown CA to fail")
+	}
+}
+
+// TestAdminTLS_ClientCertRotation 服务端要求客户端证书；证书文件轮换（修改时间变化）后新连接使用新证书
+func TestAdminTLS_ClientCertRotation(t *testing.T) {
+	var mu sync.Mutex
+	var presented []byte
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		presented = r.TLS.PeerCertificates[0].Raw
+		mu.Unlock()
+		w.Write([]byte(`{}`))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600)
+	certPath, keyPath := writeTestCert(t, dir, time.Now().Add(time.Hour), "agent")
+	cfg := &Config{AdminAPI: srv.URL, MaxRetry: 1, RetryInterval: time.Millisecond,
+		AdminTLS: &AdminTLSSpec{CAFile: caPath, CertFile: certPath, KeyFile: keyPath}}
+	client := NewApisixClient(cfg)
+	certDER := func() []byte {
+		data, _ := os.ReadFile(certPath)
+		block, _ := pem.Decode(data)
+		return block.Bytes
+	}
+	ctx := context.Background()
+	if err := client.DeleteRoute(ctx, "r1"); err != nil {
+		t.Fatalf("expected mTLS request to succeed: %v", err)
+	}
+	first := certDER()
+	mu.Lock()
+	if !bytes.Equal(presented, first) {
+		t.Error("expected configured client certificate to be presented")
+	}
+	mu.Unlock()
+
+	// 轮换证书并推后修改时间，关闭已有连接后重新握手
+	writeTestCert(t, dir, time.Now().Add(2*time.Hour), "agent")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certPath, future, future)
+	os.Chtimes(keyPath, future, future)
+	client.HTTPClient.CloseIdleConnections()
+	if err := client.DeleteRoute(ctx, "r1"); err != nil {
+		t.Fatalf("expected request with rotated certificate to succeed: %v", err)
+	}
+	mu.Lock()
+	if rotated := certDER(); bytes.Equal(rotated, first) || !bytes.Equal(presented, rotated) {
+		t.Error("expected rotated client certificate to be presented")
+	}
+	mu.Unlock()
+
+	// 未配置客户端证书时服务端拒绝握手
+	cfg.AdminTLS = &AdminTLSSpec{CAFile: caPath}
+	if err := NewApisixClient(cfg).DeleteRoute(ctx, "r1"); err == nil {
+		t.Error("expected request without client certificate to fail")
+	}
+}
+
+func TestAdminTLS_InvalidConfigFailsStartup(t *testing.T) {
+	dir := t.TempDir()
+	certPath, _ := writeTestCert(t, dir, time.Now().Add(time.Hour), "agent")
+	otherDir := t.TempDir()
+	_, otherKey := writeTestCert(t, otherDir, time.Now().Add(time.Hour), "agent")
+	for name, spec := range map[string]*AdminTLSSpec{
+		"unreadable ca":     {CAFile: filepath.Join(dir, "missing.pem")},
+		"cert key mismatch": {CertFile: certPath, KeyFile: otherKey},
+	} {
+		cfg := &Config{AdminAPI: "https://127.0.0.1:1", ServiceID: "auth", MaxRetry: 1, AdminTLS: spec}
+		err := RunContext(context.Background(), cfg)
+		if err == nil || !strings.Contains(err.Error(), "admin tls") {
+			t.Errorf("%s: expected startup to fail with admin tls error, got %v", name, err)
+		}
+	}
+}
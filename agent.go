@@ -3,14 +3,16 @@ package apisixregistryagent
 import (
 	"context"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
 type Options struct {
@@ -21,6 +23,8 @@ type Options struct {
 	ServiceNameForDiscovery string         // e.g. "zenglow-auth-service.default.svc.cluster.local"
 	ServiceID               string         // for GenerateServiceName
 	Port                    int            // for GenerateServiceName
+	Scheme                  string         // http/https/grpc/grpcs, default grpc
+	TLS                     *UpstreamTLSSpec
 }
 
 func GenerateServiceName(opts Options) string {
@@ -33,39 +37,129 @@ func GenerateServiceName(opts Options) string {
 	return opts.ServiceID
 }
 
-func BuildUpstream(opts Options) (map[string]interface{}, error) {
-	upstream := map[string]interface{}{
-		"id":     opts.ServiceID,
-		"type":   "roundrobin",
-		"scheme": "grpc",
+func BuildUpstream(opts Options) (*Upstream, error) {
+	scheme := opts.Scheme
+	if scheme == "" {
+		scheme = "grpc"
+	}
+	switch scheme {
+	case "http", "https", "grpc", "grpcs":
+	default:
+		return nil, fmt.Errorf("unsupported upstream scheme: %s", scheme)
+	}
+	upstream := &Upstream{
+		ID:     opts.ServiceID,
+		Type:   "roundrobin",
+		Scheme: scheme,
+	}
+	if opts.TLS != nil {
+		if scheme != "https" && scheme != "grpcs" {
+			return nil, fmt.Errorf("upstream tls requires scheme https or grpcs, got %s", scheme)
+		}
+		tls, err := buildUpstreamTLS(opts.TLS)
+		if err != nil {
+			return nil, err
+		}
+		upstream.TLS = tls
+		if opts.TLS.SNI != "" {
+			upstream.PassHost = "rewrite"
+			upstream.UpstreamHost = opts.TLS.SNI
+		}
 	}
 	if opts.UseDiscovery {
 		discoveryType := opts.DiscoveryType
 		if discoveryType == "" {
 			discoveryType = "dns"
 		}
-		upstream["discovery_type"] = discoveryType
+		upstream.DiscoveryType = discoveryType
 		if opts.ServiceNameForDiscovery != "" {
-			upstream["service_name"] = opts.ServiceNameForDiscovery
+			upstream.ServiceName = opts.ServiceNameForDiscovery
 		} else {
-			upstream["service_name"] = GenerateServiceName(opts)
+			upstream.ServiceName = GenerateServiceName(opts)
 		}
 	} else if len(opts.StaticNodes) > 0 {
-		upstream["nodes"] = opts.StaticNodes
+		upstream.Nodes = opts.StaticNodes
 	} else {
 		return nil, fmt.Errorf("no upstream nodes or discovery config provided")
 	}
 	return upstream, nil
 }
 
-// Agent 启动自动注册/反注册流程
+// buildUpstreamTLS 生成 upstream.tls，证书/私钥从文件读取；无需设置时返回 nil
+func buildUpstreamTLS(spec *UpstreamTLSSpec) (*UpstreamTLS, error) {
+	tls := &UpstreamTLS{Verify: spec.Verify}
+	if spec.ClientCertID != "" {
+		if spec.ClientCert != "" || spec.ClientKey != "" {
+			return nil, fmt.Errorf("upstream tls: client_cert_id conflicts with client_cert/client_key")
+		}
+		tls.ClientCertID = spec.ClientCertID
+	} else if spec.ClientCert != "" || spec.ClientKey != "" {
+		if spec.ClientCert == "" || spec.ClientKey == "" {
+			return nil, fmt.Errorf("upstream tls: client_cert and client_key must be set together")
+		}
+		cert, err := os.ReadFile(spec.ClientCert)
+		if err != nil {
+			return nil, fmt.Errorf("read upstream client_cert: %w", err)
+		}
+		key, err := os.ReadFile(spec.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("read upstream client_key: %w", err)
+		}
+		tls.ClientCert = string(cert)
+		tls.ClientKey = string(key)
+	}
+	if *tls == (UpstreamTLS{}) {
+		return nil, nil
+	}
+	return tls, nil
+}
+
+// deregisterTimeout 反注册的最长耗时，避免 Admin API 不可用时阻塞退出
+const deregisterTimeout = 30 * time.Second
+
+// Agent 启动自动注册/反注册流程，收到 SIGINT/SIGTERM 后反注册
 func Run(cfg *Config) error {
-	client := NewApisixClient(cfg)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return RunContext(ctx, cfg)
+}
+
+// RunContext 注册服务并阻塞到 ctx 取消，随后反注册；ctx 取消同样会中断进行中的注册与重试
+func RunContext(ctx context.Context, cfg *Config, clientOpts ...ClientOption) error {
+	client := NewApisixClient(cfg, clientOpts...)
+	if fb, ok := client.Backend.(failedBackend); ok {
+		return fb.err
+	}
+	if err := validateConfig(cfg); err != nil {
+		log.Printf("[APISIX-AGENT] ERROR: %v", err)
+		return err
+	}
 	serviceID := cfg.ServiceID
 	if serviceID == "" {
 		serviceID = cfg.ServiceName
 	}
+	// 0. 探测网关版本，不支持的版本直接失败
+	if err := client.EnsureVersion(ctx); err != nil {
+		if errors.Is(err, ErrUnsupportedVersion) {
+			log.Printf("[APISIX-AGENT] ERROR: %v", err)
+			return err
+		}
+		log.Printf("[APISIX-AGENT][Warn] %v, assume APISIX 3.x", err)
+	}
+	if len(cfg.GlobalRules) > 0 {
+		if err := checkGlobalRuleSpecs(serviceID, cfg.GlobalRules); err != nil {
+			log.Printf("[APISIX-AGENT] ERROR: %v", err)
+			return err
+		}
+	}
 	log.Printf("[APISIX-AGENT] Registering service: %s", serviceID)
+	// 已有 service：稳定版本重启时保留金丝雀分流；已 promote 到其他版本时拒绝启动
+	waitAdminAPI(ctx, client)
+	existingSvc, err := existingService(ctx, client, cfg, serviceID)
+	if err != nil {
+		log.Printf("[APISIX-AGENT] ERROR: %v", err)
+		return err
+	}
 	// 1. 注册 Upstream（支持服务发现/静态节点）
 	opts := Options{
 		Env:                     os.Getenv("REGISTRY_ENV"),
@@ -74,166 +168,221 @@ func Run(cfg *Config) error {
 		ServiceNameForDiscovery: os.Getenv("REGISTRY_DISCOVERY_SERVICE_NAME"),
 		ServiceID:               serviceID,
 		Port:                    cfg.ServicePort,
+		Scheme:                  os.Getenv("REGISTRY_UPSTREAM_SCHEME"),
 		StaticNodes:             map[string]int{fmt.Sprintf("127.0.0.1:%d", cfg.ServicePort): 1},
 	}
 	if cfg.Upstream != nil && len(cfg.Upstream.Nodes) > 0 {
 		opts.StaticNodes = cfg.Upstream.Nodes
 	}
+	if cfg.Upstream != nil {
+		if cfg.Upstream.Scheme != "" {
+			opts.Scheme = cfg.Upstream.Scheme
+		}
+		opts.TLS = cfg.Upstream.TLS
+	}
 
 	// 1.5 自动注册 APISIX Consumer（multi-auth）
+	waitAdminAPI(ctx, client)
 	if len(cfg.Consumers) > 0 {
-		RegisterConsumers(client, cfg.Consumers)
+		RegisterConsumers(ctx, client, cfg.Consumers)
 	}
 
+	// 节点来源：由 agent 查询注册中心/Kubernetes 等并持续同步 nodes
+	var nodeSource NodeSource
+	if cfg.Upstream != nil && cfg.Upstream.Source != nil {
+		src, nodes, err := openNodeSource(ctx, cfg.Upstream.Source)
+		if err != nil {
+			log.Printf("[APISIX-AGENT] ERROR: %v", err)
+			return err
+		}
+		nodeSource = src
+		opts.StaticNodes = nodes
+	}
+
+	// 写入前按 APISIX schema 本地校验
+	var validator *SchemaValidator
+	if cfg.ValidateSchema {
+		validator = NewSchemaValidator(client)
+	}
+
+	upstreamID := upstreamIDFor(cfg, serviceID)
 	upstream, err := BuildUpstream(opts)
 	if err != nil {
 		log.Printf("[APISIX-AGENT] BuildUpstream error: %v", err)
 	} else {
-		if err := registerUpstreamWithRetry(client, serviceID, upstream); err != nil {
-			log.Printf("[APISIX-AGENT] RegisterUpstream failed: %v", err)
+		upstream.ID = upstreamID
+		if !validatePayload(ctx, validator, "upstream", upstreamID, upstream, nil) {
+			log.Printf("[APISIX-AGENT] RegisterUpstream skipped: %s", upstreamID)
+		} else if err := client.RegisterUpstream(ctx, upstream); err != nil {
+			log.Printf("[APISIX-AGENT] RegisterUpstream failed: %v", resourceError("upstream", upstreamID, err))
 		} else {
-			log.Printf("[APISIX-AGENT] Upstream registered: %s", serviceID)
+			log.Printf("[APISIX-AGENT] Upstream registered: %s", upstreamID)
 		}
 	}
+	// 后台同步任务使用 syncCtx，反注册前取消并等待全部退出，避免进行中的写入覆盖反注册结果
+	syncCtx, cancelSync := context.WithCancel(ctx)
+	var background sync.WaitGroup
+	stopBackground := func() {
+		cancelSync()
+		background.Wait()
+	}
+	defer stopBackground()
+	goBackground := func(fn func(ctx context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			fn(syncCtx)
+		}()
+	}
+	if nodeSource != nil && upstream != nil {
+		goBackground(func(ctx context.Context) { SyncUpstreamNodes(ctx, client, upstream, nodeSource) })
+	}
+	// etcd 后端：资源绑定租约，运行期间持续续约
+	if eb, ok := client.Backend.(*EtcdBackend); ok {
+		goBackground(eb.KeepAlive)
+	}
 	// 2. 注册 Service
-	svc := map[string]interface{}{
-		"id":          serviceID,
-		"name":        cfg.ServiceName,
-		"desc":        "Auto registered by apisix-registry-agent",
-		"upstream_id": serviceID,
+	waitAdminAPI(ctx, client)
+	svc := buildService(cfg, serviceID, serviceUpstreamIDFor(cfg, serviceID))
+	serviceOrigins := map[string]string{}
+	if cfg.Service != nil {
+		serviceOrigins = pluginOrigins(cfg.Service.Plugins, "service.plugins")
+	}
+	// 金丝雀版本：service 保持指向稳定版本，通过 traffic-split 分流到当前版本
+	if canaryActive(cfg) {
+		split, err := BuildTrafficSplit(cfg.Canary, upstreamID)
+		if err != nil {
+			log.Printf("[APISIX-AGENT] BuildTrafficSplit error: %v", err)
+		} else {
+			svc.WithPlugin("traffic-split", split)
+			serviceOrigins["traffic-split"] = "canary"
+			log.Printf("[APISIX-AGENT] Canary %s enabled: weight=%d, match rules=%d", upstreamID, cfg.Canary.Weight, len(cfg.Canary.Match))
+		}
+	} else if keepTrafficSplit(existingSvc, svc) {
+		serviceOrigins["traffic-split"] = "canary"
+		log.Printf("[APISIX-AGENT] Keeping traffic-split of running canary on service %s", serviceID)
 	}
-	if err := registerServiceWithRetry(client, serviceID, svc); err != nil {
+	if !validatePayload(ctx, validator, "service", serviceID, svc, serviceOrigins) {
+		return fmt.Errorf("service %s: schema validation failed", serviceID)
+	}
+	if err := client.RegisterService(ctx, svc); err != nil {
+		err = resourceError("service", serviceID, err)
 		log.Printf("[APISIX-AGENT] RegisterService failed: %v", err)
 		return err
 	}
 	log.Printf("[APISIX-AGENT] Service registered: %s", serviceID)
-	// 3. 注册 Route
-	var customRouteMap map[string]interface{}
-	if len(cfg.Routes) > 0 {
-		customRouteMap = make(map[string]interface{})
-		for _, cr := range cfg.Routes {
-			customRouteMap[cr.URI] = cr
+	// 2.5 注册 SSL 证书，证书文件变化时自动更新
+	var sslManager *SSLManager
+	if len(cfg.SSLs) > 0 {
+		sslManager = NewSSLManager(client, cfg, serviceID)
+		sslManager.Sync(ctx)
+		goBackground(sslManager.Watch)
+	}
+	// 2.6 注册全局规则（只管理本 agent 的规则）
+	if len(cfg.GlobalRules) > 0 {
+		RegisterGlobalRules(ctx, client, validator, serviceID, cfg.GlobalRules)
+	}
+	// 插件元数据为网关共享配置，反注册时不删除
+	if len(cfg.PluginMetadata) > 0 {
+		markers := RegisterPluginMetadata(ctx, client, validator, cfg.PluginMetadata, metadataMarkers(existingSvc))
+		if len(markers) > 0 {
+			labels := map[string]interface{}{}
+			for name, fp := range markers {
+				labels[metadataLabelPrefix+name] = fp
+			}
+			if err := client.PatchService(ctx, serviceID, map[string]interface{}{"labels": labels}); err != nil {
+				log.Printf("[APISIX-AGENT][Warn] Record plugin metadata owner on service %s: %v", serviceID, err)
+			}
+		}
+	}
+	// 2.7 注册插件组，路由通过 plugin_config_id 引用，需先于路由写入；
+	// 未写入的插件组记入 failedPluginConfigs，引用它的路由同样跳过，避免被 APISIX 拒绝
+	failedPluginConfigs := map[string]bool{}
+	for i, spec := range cfg.PluginConfigs {
+		pc := buildPluginConfig(serviceID, spec)
+		origins := pluginOrigins(spec.Plugins, fmt.Sprintf("plugin_configs[%d].plugins", i))
+		if !validatePayload(ctx, validator, "plugin_config", pc.ID, pc, origins) {
+			failedPluginConfigs[pc.ID] = true
+			continue
+		}
+		if err := client.RegisterPluginConfig(ctx, pc); err != nil {
+			failedPluginConfigs[pc.ID] = true
+			log.Printf("[APISIX-AGENT] RegisterPluginConfig failed: %v", resourceError("plugin_config", pc.ID, err))
+		} else {
+			log.Printf("[APISIX-AGENT] Plugin config registered: %s", pc.ID)
 		}
 	}
+	// 3. 注册 Route
+	waitAdminAPI(ctx, client)
+	// uri -> cfg.Routes 下标
+	customRouteMap := make(map[string]int)
+	for j, cr := range cfg.Routes {
+		customRouteMap[cr.URI] = j
+	}
 	routes, _ := ParseProtoHttpRules(cfg.ProtoPath)
+	var routeTasks []BulkTask
 	for i, r := range routes {
 		id := fmt.Sprintf("%s-%d", serviceID, i)
-		var route map[string]interface{}
+		var route *Route
+		var origins map[string]string
 		// 优先使用自定义路由配置
-		if customRouteMap != nil {
-			if cr, ok := customRouteMap[r["uri"].(string)]; ok {
-				// 用自定义配置覆盖 proto 解析结果
-				route = map[string]interface{}{
-					"id":         id,
-					"name":       id,
-					"desc":       "Auto registered by apisix-registry-agent (custom config)",
-					"service_id": serviceID,
-					"uri":        cr.(RouteConfig).URI,
-				}
-				if len(cr.(RouteConfig).Methods) > 0 {
-					route["methods"] = cr.(RouteConfig).Methods
-				}
-				if len(cr.(RouteConfig).Plugins) > 0 {
-					plugins := map[string]interface{}{}
-					for _, p := range cr.(RouteConfig).Plugins {
-						pluginConfig := make(map[string]interface{})
-						for k, v := range p.Config {
-							pluginConfig[k] = v
-						}
-						// 自动补全 grpc-transcode method 字段
-						if p.Name == "grpc-transcode" {
-							if pluginConfig["method"] == nil {
-								if gm, ok := r["grpc_method"]; ok && gm != nil && gm != "" {
-									pluginConfig["method"] = gm
-									if cfg.Debug {
-										log.Printf("[APISIX-AGENT][DEBUG] auto fill grpc-transcode method: %v", gm)
-									}
-								} else {
-									log.Printf("[APISIX-AGENT] ERROR: grpc-transcode method missing for custom route %v, please set method field", cr.(RouteConfig).URI)
-								}
-							}
-							// 自动补全 proto_id 字段
-							if pluginConfig["proto_id"] == nil && cfg.ProtoPath != "" {
-								pluginConfig["proto_id"] = serviceID
-								if cfg.Debug {
-									log.Printf("[APISIX-AGENT][DEBUG] auto fill grpc-transcode proto_id: %v", serviceID)
-								}
-							}
-							// 自动补全 service 字段
-							if pluginConfig["service"] == nil && cfg.ServiceName != "" {
-								pluginConfig["service"] = "micro." + capitalize(cfg.ServiceName) + "Service"
-								if cfg.Debug {
-									log.Printf("[APISIX-AGENT][DEBUG] auto fill grpc-transcode service: %v", pluginConfig["service"])
-								}
-							}
-							// 强校验必填字段
-							for _, key := range []string{"method", "proto_id", "service"} {
-								if pluginConfig[key] == nil || pluginConfig[key] == "" {
-									log.Printf("[APISIX-AGENT] ERROR: grpc-transcode %s missing for custom route %v, please set %s field", key, cr.(RouteConfig).URI, key)
-								}
-							}
-						}
-						plugins[p.Name] = pluginConfig
-					}
-					route["plugins"] = plugins
-				}
-				if cfg.Debug {
-					log.Printf("[APISIX-AGENT][DEBUG] custom route to register: %+v", route)
-				}
-				if err := client.RegisterRoute(id, route); err != nil {
-					log.Printf("[APISIX-AGENT] RegisterRoute failed: %v", err)
-				} else {
-					log.Printf("[APISIX-AGENT] Route registered: %s %v", id, route)
-				}
-				continue
+		if j, ok := customRouteMap[r["uri"].(string)]; ok {
+			route = buildCustomRoute(cfg, serviceID, id, r, cfg.Routes[j])
+			origins = pluginOrigins(cfg.Routes[j].Plugins, fmt.Sprintf("routes[%d].plugins", j))
+			if cfg.Debug {
+				log.Printf("[APISIX-AGENT][DEBUG] custom route to register: %+v", route)
+			}
+		} else {
+			if cfg.Debug {
+				log.Printf("[APISIX-AGENT][DEBUG] parsed route: %+v", r)
+			}
+			route = buildProtoRoute(cfg, serviceID, id, r)
+			origins = pluginOrigins(cfg.RoutePlugins, "route_plugins")
+			if cfg.Debug {
+				log.Printf("[APISIX-AGENT][DEBUG] final route to register: %+v", route)
 			}
 		}
-		// ...原有 proto 解析注册逻辑...
-		if cfg.Debug {
-			log.Printf("[APISIX-AGENT][DEBUG] parsed route: %+v", r)
-		}
-		route = map[string]interface{}{
-			"id":         id,
-			"name":       id,
-			"desc":       "Auto registered by apisix-registry-agent",
-			"service_id": serviceID,
-			"uri":        r["uri"],
+		if failedPluginConfigs[route.PluginConfigID] {
+			log.Printf("[APISIX-AGENT] RegisterRoute skipped: %s references plugin_config %s that was not registered", id, route.PluginConfigID)
+			continue
 		}
-		if ms, ok := r["methods"]; ok {
-			route["methods"] = ms
+		if !validatePayload(ctx, validator, "route", id, route, origins) {
+			continue
 		}
-		if len(cfg.RoutePlugins) > 0 {
-			plugins := map[string]interface{}{}
-			for _, p := range cfg.RoutePlugins {
-				pluginConfig := make(map[string]interface{})
-				for k, v := range p.Config {
-					pluginConfig[k] = v
-				}
-				if p.Name == "grpc-transcode" {
-					gm, ok := r["grpc_method"]
-					if !ok || gm == nil || gm == "" {
-						log.Printf("[APISIX-AGENT] ERROR: grpc_method not found for route %v, skip grpc-transcode method", r)
-						continue
-					}
-					pluginConfig["method"] = gm
-					if cfg.Debug {
-						log.Printf("[APISIX-AGENT][DEBUG] grpc-transcode method set: %v", gm)
-					}
-				}
-				plugins[p.Name] = pluginConfig
+		routeTasks = append(routeTasks, BulkTask{Kind: "route", ID: id, Do: func(ctx context.Context) error {
+			if err := client.RegisterRoute(ctx, route); err != nil {
+				return err
 			}
-			route["plugins"] = plugins
-		}
-		if cfg.Debug {
-			log.Printf("[APISIX-AGENT][DEBUG] final route to register: %+v", route)
+			log.Printf("[APISIX-AGENT] Route registered: %s %+v", id, route)
+			return nil
+		}})
+	}
+	// 四层路由，未配置 upstream 时与 service 使用同一个 upstream
+	for i, spec := range cfg.StreamRoutes {
+		id := streamRouteID(serviceID, i, spec)
+		route, err := buildStreamRoute(id, serviceUpstreamIDFor(cfg, serviceID), spec)
+		if err != nil {
+			log.Printf("[APISIX-AGENT] ERROR: %v", err)
+			continue
 		}
-		if err := registerRouteWithRetry(client, id, route); err != nil {
-			log.Printf("[APISIX-AGENT] RegisterRoute failed: %v", err)
-		} else {
-			log.Printf("[APISIX-AGENT] Route registered: %s %v", id, route)
+		origins := pluginOrigins(spec.Plugins, fmt.Sprintf("stream_routes[%d].plugins", i))
+		if !validatePayload(ctx, validator, "stream_route", id, route, origins) {
+			continue
 		}
+		routeTasks = append(routeTasks, BulkTask{Kind: "stream_route", ID: id, Do: func(ctx context.Context) error {
+			if err := client.RegisterStreamRoute(ctx, route); err != nil {
+				return err
+			}
+			log.Printf("[APISIX-AGENT] Stream route registered: %s %s:%d", id, route.ServerAddr, route.ServerPort)
+			return nil
+		}})
+	}
+	// 路由之间相互独立，并发写入；service/upstream 已在前面写入完成
+	if err := RunBulk(ctx, cfg.Concurrency, routeTasks); err != nil {
+		log.Printf("[APISIX-AGENT] RegisterRoute failed: %v", err)
 	}
 	// 4. 注册 Proto
+	waitAdminAPI(ctx, client)
 	if cfg.ProtoPbPath != "" {
 		// 判断是否为 .pb 文件（descriptor），需要 base64 编码
 		if file, err := os.Open(cfg.ProtoPbPath); err == nil {
@@ -247,8 +396,8 @@ func Run(cfg *Config) error {
 					// 普通 proto 文件，直接用文本
 					content = string(protoContent)
 				}
-				if err := registerProtoWithRetry(client, serviceID, content); err != nil {
-					log.Printf("[APISIX-AGENT] RegisterProto failed: %v", err)
+				if err := client.RegisterProto(ctx, &Proto{ID: serviceID, Content: content}); err != nil {
+					log.Printf("[APISIX-AGENT] RegisterProto failed: %v", resourceError("proto", serviceID, err))
 				} else {
 					log.Printf("[APISIX-AGENT] Proto registered: %s", serviceID)
 				}
@@ -261,39 +410,103 @@ func Run(cfg *Config) error {
 	}
 	// 5. 捕获退出信号，自动反注册
 	log.Printf("[APISIX-AGENT] Waiting for shutdown signal...")
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
 	<-ctx.Done()
 	log.Printf("[APISIX-AGENT] Deregistering...")
+	stopBackground()
+	// 注册用的 ctx 已取消，反注册使用独立的带超时 ctx；熔断打开时也要尝试删除，不经过熔断器
+	ctx, cancel := context.WithTimeout(withoutBreaker(context.Background()), deregisterTimeout)
+	defer cancel()
+	// etcd 后端：反注册结束后撤销租约，删除失败残留的资源随租约一并清理；
+	// 留给其他版本继续使用的共享资源先解除租约绑定
+	eb, _ := client.Backend.(*EtcdBackend)
+	if eb != nil {
+		defer func() {
+			if err := eb.Close(ctx); err != nil {
+				log.Printf("[APISIX-AGENT][Warn] %v", err)
+			}
+		}()
+	}
+	detachShared := func() {
+		if eb == nil {
+			return
+		}
+		if err := eb.Detach(ctx); err != nil {
+			log.Printf("[APISIX-AGENT][Warn] etcd detach shared resources: %v", err)
+		}
+	}
+	// 金丝雀实例退出时只回滚自身分流，service/route 仍由稳定版本使用
+	if canaryActive(cfg) {
+		if err := RollbackCanary(ctx, client, serviceID, cfg.ServiceVersion); err != nil {
+			log.Printf("[APISIX-AGENT][Warn] RollbackCanary error: %v", err)
+		}
+		detachShared()
+		log.Printf("[APISIX-AGENT] Deregistration complete.")
+		return nil
+	}
+	// 其他版本已 promote：共享资源由新版本使用，本实例的 upstream 已在 promote 时删除
+	if current, ok := servedByOther(ctx, client, serviceID, upstreamID); ok {
+		log.Printf("[APISIX-AGENT] Service %s is now served by upstream %s, skip deregistration of shared resources", serviceID, current)
+		detachShared()
+		log.Printf("[APISIX-AGENT] Deregistration complete.")
+		return nil
+	}
 	// 彻底清理所有与 proto_id 相关的路由
-	var failedRoutes []string
 	protoRoutes, _ := ParseProtoHttpRules(cfg.ProtoPath)
+	deleteTasks := make([]BulkTask, 0, len(protoRoutes))
 	for i := range protoRoutes {
 		id := fmt.Sprintf("%s-%d", serviceID, i)
-		if err := deleteRouteWithRetry(client, id); err != nil {
-			log.Printf("[APISIX-AGENT][Warn] Delete route error . %v", err)
-			failedRoutes = append(failedRoutes, id)
-		}
+		deleteTasks = append(deleteTasks, BulkTask{Kind: "route", ID: id, Do: func(ctx context.Context) error {
+			return client.DeleteRoute(ctx, id)
+		}})
+	}
+	for i, spec := range cfg.StreamRoutes {
+		id := streamRouteID(serviceID, i, spec)
+		deleteTasks = append(deleteTasks, BulkTask{Kind: "stream_route", ID: id, Do: func(ctx context.Context) error {
+			return client.DeleteStreamRoute(ctx, id)
+		}})
 	}
 	// 检查 APISIX 是否还有残留路由引用 proto_id
-	if len(failedRoutes) > 0 {
-		log.Printf("[APISIX-AGENT][Warn] Some routes failed to delete: %v", failedRoutes)
+	if err := RunBulk(ctx, cfg.Concurrency, deleteTasks); err != nil {
+		log.Printf("[APISIX-AGENT][Warn] Some routes failed to delete: %v", err)
 	}
 	// 主动查询 APISIX 路由，彻底清理所有 proto_id 相关路由
-	if err := forceDeleteProtoRelatedRoutes(client, serviceID); err != nil {
+	if err := forceDeleteProtoRelatedRoutes(ctx, client, serviceID); err != nil {
 		log.Printf("[APISIX-AGENT][Warn] forceDeleteProtoRelatedRoutes: %v", err)
 	}
-	if err := deleteProtoWithRetry(client, serviceID); err != nil {
-		log.Printf("[APISIX-AGENT][Warn] DeleteProto error: %v", err)
+	if err := client.DeleteProto(ctx, serviceID); err != nil {
+		log.Printf("[APISIX-AGENT][Warn] DeleteProto error: %v", resourceError("proto", serviceID, err))
+	}
+	// 插件组在引用它的路由删除后再删除
+	for _, spec := range cfg.PluginConfigs {
+		id := pluginConfigID(serviceID, spec.ID)
+		if err := client.DeletePluginConfig(ctx, id); err != nil {
+			log.Printf("[APISIX-AGENT][Warn] DeletePluginConfig error: %v", resourceError("plugin_config", id, err))
+		}
+	}
+	if len(cfg.GlobalRules) > 0 {
+		DeleteGlobalRules(ctx, client, serviceID)
+	}
+	client.DeleteService(ctx, serviceID)
+	if sslManager != nil {
+		sslManager.Delete(ctx)
 	}
-	deleteServiceWithRetry(client, serviceID)
 	if cfg.Upstream != nil {
-		deleteUpstreamWithRetry(client, serviceID)
+		client.DeleteUpstream(ctx, upstreamID)
 	}
 	log.Printf("[APISIX-AGENT] Deregistration complete.")
 	return nil
 }
 
+// waitAdminAPI Admin API 熔断打开时整体等待冷却结束再进入下一阶段，
+// 避免各阶段分别耗尽重试并刷屏日志
+func waitAdminAPI(ctx context.Context, client *ApisixClient) {
+	if client.BreakerState() != BreakerOpen {
+		return
+	}
+	log.Printf("[APISIX-AGENT][Warn] Admin API unavailable (circuit breaker open), backing off")
+	client.Breaker.Wait(ctx)
+}
+
 // encodeBase64 工具函数
 func encodeBase64(data []byte) string {
 	return base64.StdEncoding.EncodeToString(data)
@@ -307,112 +520,22 @@ func capitalize(s string) string {
 	return strings.ToUpper(s[:1]) + s[1:]
 }
 
-// 幂等重试工具
-func retryN(n int, op func() error, desc string) error {
-	var err error
-	for i := 0; i < n; i++ {
-		err = op()
-		if err == nil {
-			return nil
-		}
-		log.Printf("[APISIX-AGENT][Retry] %s failed (try %d/%d): %v", desc, i+1, n, err)
-	}
-	return err
-}
-
-// RegisterRoute 幂等重试
-func registerRouteWithRetry(client *ApisixClient, id string, route map[string]interface{}) error {
-	desc := "RegisterRoute " + id
-	return retryN(3, func() error {
-		return client.RegisterRoute(id, route)
-	}, desc)
-}
-
-// DeleteRoute 幂等重试
-func deleteRouteWithRetry(client *ApisixClient, id string) error {
-	desc := "DeleteRoute " + id
-	return retryN(3, func() error {
-		return client.DeleteRoute(id)
-	}, desc)
-}
-
-// RegisterService 幂等重试
-func registerServiceWithRetry(client *ApisixClient, id string, svc map[string]interface{}) error {
-	desc := "RegisterService " + id
-	return retryN(3, func() error {
-		return client.RegisterService(id, svc)
-	}, desc)
-}
-
-// RegisterUpstream 幂等重试
-func registerUpstreamWithRetry(client *ApisixClient, id string, upstream map[string]interface{}) error {
-	desc := "RegisterUpstream " + id
-	return retryN(3, func() error {
-		return client.RegisterUpstream(id, upstream)
-	}, desc)
-}
-
-// RegisterProto 幂等重试
-func registerProtoWithRetry(client *ApisixClient, id string, content string) error {
-	desc := "RegisterProto " + id
-	return retryN(3, func() error {
-		return client.RegisterProto(id, content)
-	}, desc)
-}
-
-// DeleteProto 幂等重试
-func deleteProtoWithRetry(client *ApisixClient, id string) error {
-	desc := "DeleteProto " + id
-	return retryN(3, func() error {
-		return client.DeleteProto(id)
-	}, desc)
-}
-
-// DeleteService 幂等重试
-func deleteServiceWithRetry(client *ApisixClient, id string) error {
-	desc := "DeleteService " + id
-	return retryN(3, func() error {
-		return client.DeleteService(id)
-	}, desc)
-}
-
-// DeleteUpstream 幂等重试
-func deleteUpstreamWithRetry(client *ApisixClient, id string) error {
-	desc := "DeleteUpstream " + id
-	return retryN(3, func() error {
-		return client.DeleteUpstream(id)
-	}, desc)
-}
-
 // 强制彻底清理所有引用 proto_id 的路由
-func forceDeleteProtoRelatedRoutes(client *ApisixClient, protoID string) error {
+func forceDeleteProtoRelatedRoutes(ctx context.Context, client *ApisixClient, protoID string) error {
 	// 查询所有路由
-	resp, err := client.doRequest("GET", "/routes", nil)
+	routes, err := client.ListRoutes(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("query routes failed: %w", err)
 	}
-	var data struct {
-		Nodes []struct {
-			Value map[string]interface{} `json:"value"`
-		} `json:"nodes"`
-	}
-	if err := json.Unmarshal(resp, &data); err != nil {
-		return fmt.Errorf("unmarshal routes failed: %w", err)
-	}
-	for _, node := range data.Nodes {
-		v := node.Value
-		plugins, ok := v["plugins"].(map[string]interface{})
-		if !ok {
-			continue
-		}
-		gt, ok := plugins["grpc-transcode"].(map[string]interface{})
+	for _, route := range routes {
+		gt, ok := route.Plugins["grpc-transcode"].(map[string]interface{})
 		if !ok {
 			continue
 		}
-		if pid, ok := gt["proto_id"].(string); ok && pid == protoID {
-			if id, ok := v["id"].(string); ok {
-				log.Printf("[APISIX-AGENT][Warn] Force delete route %s referencing proto_id %s", id, protoID)
-				client.DeleteRoute(id)
+		if pid, ok := gt["proto_id"].(string); ok && pid == protoID && route.ID != "" {
+			log.Printf("[APISIX-AGENT][Warn] Force delete route %s referencing proto_id %s", route.ID, protoID)
+			if err := client.DeleteRoute(ctx, route.ID); err != nil {
+				log.Printf("[APISIX-AGENT][Warn] Force delete failed: %v", resourceError("route", route.ID, err))
 			}
 		}
 	}
@@ -1,6 +1,8 @@
 package apisixregistryagent
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -16,7 +18,7 @@ func TestBuildUpstream_Static(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if up["nodes"] == nil {
+	if up.Nodes == nil {
 		t.Errorf("expected nodes in upstream")
 	}
 }
@@ -32,10 +34,48 @@ func TestBuildUpstream_Discovery(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if up["discovery_type"] != "kubernetes" {
-		t.Errorf("expected discovery_type kubernetes, got %v", up["discovery_type"])
+	if up.DiscoveryType != "kubernetes" {
+		t.Errorf("expected discovery_type kubernetes, got %v", up.DiscoveryType)
 	}
-	if up["service_name"] != "test-service.default.svc.cluster.local" {
-		t.Errorf("unexpected service_name: %v", up["service_name"])
+	if up.ServiceName != "test-service.default.svc.cluster.local" {
+		t.Errorf("unexpected service_name: %v", up.ServiceName)
+	}
+}
+
+func TestBuildUpstream_TLS(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.crt")
+	keyPath := filepath.Join(dir, "client.key")
+	os.WriteFile(certPath, []byte("CERT"), 0o600)
+	os.WriteFile(keyPath, []byte("KEY"), 0o600)
+	verify := true
+	opts := Options{
+		ServiceID:   "test-service",
+		StaticNodes: map[string]int{"test-service:8082": 1},
+		Scheme:      "grpcs",
+		TLS: &UpstreamTLSSpec{
+			ClientCert: certPath,
+			ClientKey:  keyPath,
+			SNI:        "backend.internal",
+			Verify:     &verify,
+		},
+	}
+	up, err := BuildUpstream(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if up.Scheme != "grpcs" {
+		t.Errorf("expected scheme grpcs, got %v", up.Scheme)
+	}
+	if up.TLS == nil || up.TLS.ClientCert != "CERT" || up.TLS.ClientKey != "KEY" || !*up.TLS.Verify {
+		t.Errorf("unexpected tls: %+v", up.TLS)
+	}
+	if up.PassHost != "rewrite" || up.UpstreamHost != "backend.internal" {
+		t.Errorf("unexpected sni settings: %+v", up)
+	}
+
+	opts.Scheme = "grpc"
+	if _, err := BuildUpstream(opts); err == nil {
+		t.Errorf("expected error for tls with plain grpc scheme")
 	}
 }
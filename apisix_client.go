@@ -2,6 +2,7 @@ package apisixregistryagent
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,24 +12,155 @@ import (
 )
 
 type ApisixClient struct {
-	Debug         bool
-	AdminAPI      string
-	AdminKey      string
-	MaxRetry      int
-	RetryInterval time.Duration
+	Debug      bool
+	AdminAPI   string
+	AdminKey   string
+	Retry      RetryPolicy
+	HTTPClient *http.Client
+	Version    *GatewayVersion // 网关版本，为空时按 v3 处理，可通过 EnsureVersion 探测
+
+	Backend   Backend         // 非 Admin API 后端（standalone 等），nil 表示通过 HTTP 访问 Admin API
+	Breaker   *CircuitBreaker // Admin API 熔断器，nil 表示不启用
+	limiter   *rateLimiter    // QPS 限制，nil 不限制
+	keySource *cachedSecret   // 设置后 admin key 从该来源读取，AdminKey 仅作为读取失败时的兜底
+}
+
+// ClientOption 用于定制 ApisixClient，例如注入自定义 http.Client/RoundTripper
+type ClientOption func(*ApisixClient)
+
+// WithHTTPClient 使用自定义 http.Client（超时、代理、tracing 等）
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *ApisixClient) {
+		c.HTTPClient = hc
+	}
+}
+
+// WithTransport 在默认 http.Client 上替换 RoundTripper
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(c *ApisixClient) {
+		c.HTTPClient = &http.Client{Timeout: c.HTTPClient.Timeout, Transport: rt}
+	}
+}
+
+// WithBackend 使用自定义存储后端替代 Admin API
+func WithBackend(b Backend) ClientOption {
+	return func(c *ApisixClient) {
+		c.Backend = b
+	}
+}
+
+// newBackend 根据配置创建存储后端，admin_api 返回 nil
+func newBackend(cfg *Config) (Backend, error) {
+	switch cfg.Backend {
+	case "", "admin_api":
+		return nil, nil
+	case "standalone":
+		return NewStandaloneBackend(cfg.Standalone)
+	case "etcd":
+		return NewEtcdBackend(cfg.Etcd, cfg.TTL)
+	default:
+		return nil, fmt.Errorf("unsupported backend: %s", cfg.Backend)
+	}
+}
+
+// WithAdminKeyProvider 从 SecretProvider 读取 admin key，每 refresh 重新读取一次；
+// 收到 401/403 时立即重新读取并重试一次
+func WithAdminKeyProvider(p SecretProvider, refresh time.Duration) ClientOption {
+	return func(c *ApisixClient) {
+		c.keySource = newCachedSecret(p, refresh)
+	}
+}
+
+// adminKeyProvider 根据配置创建 admin key 来源，admin_key_source 优先于 admin_key_file
+func adminKeyProvider(cfg *Config) (SecretProvider, time.Duration, error) {
+	if cfg.AdminKeySource != nil {
+		p, err := NewSecretProvider(cfg.AdminKeySource)
+		return p, cfg.AdminKeySource.RefreshInterval, err
+	}
+	if cfg.AdminKeyFile != "" {
+		return &FileSecret{Path: cfg.AdminKeyFile}, 0, nil
+	}
+	return nil, 0, nil
+}
+
+func NewApisixClient(cfg *Config, opts ...ClientOption) *ApisixClient {
+	timeout := cfg.RequestTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	c := &ApisixClient{
+		Debug:      cfg.Debug,
+		AdminAPI:   cfg.AdminAPI,
+		AdminKey:   cfg.AdminKey,
+		Retry:      DefaultRetryPolicy(cfg),
+		HTTPClient: &http.Client{Timeout: timeout},
+		limiter:    newRateLimiter(cfg.QPS),
+	}
+	if cfg.BreakerThreshold >= 0 {
+		c.Breaker = NewCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
+	}
+	if cfg.ApisixVersion != "" && cfg.ApisixVersion != "auto" {
+		if v, err := ParseGatewayVersion(cfg.ApisixVersion); err != nil {
+			log.Printf("[APISIX-AGENT] ERROR: apisix_version: %v, will detect automatically", err)
+		} else {
+			c.Version = &v
+		}
+	}
+	// Admin TLS 配置错误时不能回退到默认 transport 继续携带 admin key 发出请求，与后端配置错误一样使启动失败
+	var tlsErr error
+	if cfg.AdminTLS != nil {
+		tlsConfig, err := NewAdminTLSConfig(cfg.AdminTLS)
+		if err != nil {
+			log.Printf("[APISIX-AGENT] ERROR: admin tls: %v", err)
+			tlsErr = fmt.Errorf("admin tls: %w", err)
+		} else {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = tlsConfig
+			c.HTTPClient.Transport = transport
+		}
+	}
+	if p, refresh, err := adminKeyProvider(cfg); err != nil {
+		log.Printf("[APISIX-AGENT] ERROR: admin key source: %v", err)
+	} else if p != nil {
+		c.keySource = newCachedSecret(p, refresh)
+	}
+	if tlsErr != nil {
+		c.Backend = failedBackend{err: tlsErr}
+	} else if b, err := newBackend(cfg); err != nil {
+		// 配置了非 HTTP 后端却无法创建时，不能静默回退到 Admin API
+		log.Printf("[APISIX-AGENT] ERROR: backend: %v", err)
+		c.Backend = failedBackend{err: fmt.Errorf("backend %q: %w", cfg.Backend, err)}
+	} else if b != nil {
+		c.Backend = b
+		log.Printf("[APISIX-AGENT] Using %s backend", cfg.Backend)
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-func NewApisixClient(cfg *Config) *ApisixClient {
-	return &ApisixClient{
-		Debug:         cfg.Debug,
-		AdminAPI:      cfg.AdminAPI,
-		AdminKey:      cfg.AdminKey,
-		MaxRetry:      cfg.MaxRetry,
-		RetryInterval: cfg.RetryInterval,
+// BreakerState 返回熔断器状态，供调用方在 Admin API 不可用时整体退避
+func (c *ApisixClient) BreakerState() BreakerState {
+	return c.Breaker.State()
+}
+
+// adminKey 返回当前 admin key；读取失败时沿用上次的值，没有则使用静态 AdminKey
+func (c *ApisixClient) adminKey(ctx context.Context, force bool) string {
+	if c.keySource == nil {
+		return c.AdminKey
+	}
+	key, err := c.keySource.Secret(ctx, force)
+	if err != nil {
+		log.Printf("[APISIX-AGENT][Warn] Read admin key failed: %v", err)
 	}
+	if key == "" {
+		return c.AdminKey
+	}
+	return key
 }
 
-func (c *ApisixClient) doRequest(method, path string, body interface{}) ([]byte, error) {
+func (c *ApisixClient) doRequest(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
 	var data []byte
 	var err error
 	if body != nil {
@@ -37,9 +169,40 @@ func (c *ApisixClient) doRequest(method, path string, body interface{}) ([]byte,
 			return nil, err
 		}
 	}
+	if c.Backend != nil {
+		if c.Debug {
+			log.Printf("[APISIX-AGENT][DEBUG] %s %s backend request body: %s \n", method, path, string(data))
+		}
+		respBody, err := c.Backend.Request(ctx, method, path, data)
+		// 与 Admin API 相同：删除不存在的资源视为成功，保证反注册幂等
+		if method == "DELETE" && IsNotFound(err) {
+			return []byte(`{}`), nil
+		}
+		return respBody, err
+	}
 	url := fmt.Sprintf("%s%s", c.AdminAPI, path)
-	for i := 0; i < c.MaxRetry; i++ {
-		req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	start := time.Now()
+	var lastErr error
+	key := c.adminKey(ctx, false)
+	keyRefreshed := false
+	// 半开探测请求在任何返回路径上都要归还名额（Success/Failure 已记录时为空操作）
+	release := func() {}
+	defer func() { release() }()
+	breaker := c.breakerFor(ctx)
+	for attempt := 0; attempt < c.Retry.MaxAttempts; attempt++ {
+		release()
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		// 熔断打开时不再发出请求；已有失败时返回最后一次的错误
+		var err error
+		if release, err = breaker.acquire(); err != nil {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w: %w", err, lastErr)
+			}
+			return nil, fmt.Errorf("%s %s: %w", method, path, err)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
 
 		if c.Debug {
 			log.Printf("[APISIX-AGENT][DEBUG] %s %s request body: %s \n", method, url, string(data))
@@ -49,96 +212,269 @@ func (c *ApisixClient) doRequest(method, path string, body interface{}) ([]byte,
 			return nil, err
 		}
 
-		req.Header.Set("X-API-KEY", c.AdminKey)
+		req.Header.Set("X-API-KEY", key)
 
 		if body != nil {
 			req.Header.Set("Content-Type", "application/json")
 		}
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := c.HTTPClient.Do(req)
 		var respBody []byte
 
 		if resp != nil {
-			defer resp.Body.Close()
 			respBody, _ = io.ReadAll(resp.Body)
+			resp.Body.Close()
 		}
 
 		if c.Debug {
 			log.Printf("[APISIX-AGENT][DEBUG] %s %s response body: %s \n", method, url, string(respBody))
 		}
 
-		if err == nil && resp != nil && resp.StatusCode < 300 {
-			return respBody, nil
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		// 网络错误与 5xx 计为网关不可用，其余响应说明网关正常
+		if err != nil || statusCode >= 500 {
+			if breaker.Failure() {
+				log.Printf("[APISIX-AGENT] ERROR: Admin API circuit breaker opened after consecutive failures")
+			}
 		} else {
-			statusCode := 0
-			if resp != nil {
-				statusCode = resp.StatusCode
+			breaker.Success()
+		}
+		if err == nil && statusCode < 300 {
+			return respBody, nil
+		}
+		// 删除不存在的资源视为成功，保证反注册幂等
+		if err == nil && method == "DELETE" && statusCode == http.StatusNotFound {
+			return respBody, nil
+		}
+		// key 可能已轮换：重新读取一次，变化时立即重试（不计入重试次数）
+		if err == nil && (statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden) && c.keySource != nil && !keyRefreshed {
+			keyRefreshed = true
+			if newKey := c.adminKey(ctx, true); newKey != key {
+				log.Printf("[APISIX-AGENT] Admin key rotated, retrying %s %s", method, url)
+				key = newKey
+				attempt--
+				continue
 			}
-			log.Printf("[APISIX-AGENT][WARN] %s %s failed: status=%d, err=%v, resp=%s", method, url, statusCode, err, string(respBody))
 		}
-		time.Sleep(c.RetryInterval * time.Duration(i+1))
+		log.Printf("[APISIX-AGENT][WARN] %s %s failed: status=%d, err=%v, resp=%s", method, url, statusCode, err, string(respBody))
+		apiErr := &APIError{
+			Method:     method,
+			Path:       path,
+			StatusCode: statusCode,
+			Message:    parseErrorMessage(respBody),
+			Body:       string(respBody),
+			Attempts:   attempt + 1,
+			Err:        err,
+		}
+		lastErr = apiErr
+		if err == nil && !retryableStatus(statusCode) {
+			return nil, lastErr
+		}
+		if attempt+1 >= c.Retry.MaxAttempts {
+			break
+		}
+		wait := c.Retry.Backoff(attempt)
+		if statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable {
+			if ra := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ra > wait {
+				wait = ra
+			}
+		}
+		if c.Retry.MaxElapsed > 0 && time.Since(start)+wait > c.Retry.MaxElapsed {
+			log.Printf("[APISIX-AGENT][WARN] %s %s: retry budget %v exhausted", method, url, c.Retry.MaxElapsed)
+			break
+		}
+		// ctx 取消时立即停止重试
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
 	}
-	return nil, fmt.Errorf("APISIX request failed after %d retries", c.MaxRetry)
+	return nil, lastErr
 }
 
-// Service/Route/Upstream/Proto 注册、反注册接口
-func (c *ApisixClient) RegisterService(id string, svc map[string]interface{}) error {
-	_, err := c.doRequest("PUT", "/services/"+id, svc)
+// Service/Route/Upstream/Proto/Consumer 注册、反注册接口
+func (c *ApisixClient) RegisterService(ctx context.Context, svc *Service) error {
+	if svc.ID == "" {
+		return fmt.Errorf("register service: id is required")
+	}
+	_, err := c.doRequest(ctx, "PUT", "/services/"+svc.ID, svc)
+	return err
+}
+
+// PatchService 局部更新 service，patch 中值为 nil 的字段会被 APISIX 删除
+func (c *ApisixClient) PatchService(ctx context.Context, id string, patch map[string]interface{}) error {
+	_, err := c.doRequest(ctx, "PATCH", "/services/"+id, patch)
+	return err
+}
+func (c *ApisixClient) DeleteService(ctx context.Context, id string) error {
+	_, err := c.doRequest(ctx, "DELETE", "/services/"+id, nil)
+	return err
+}
+func (c *ApisixClient) RegisterRoute(ctx context.Context, route *Route) error {
+	if route.ID == "" {
+		return fmt.Errorf("register route: id is required")
+	}
+	_, err := c.doRequest(ctx, "PUT", "/routes/"+route.ID, route)
+	return err
+}
+func (c *ApisixClient) DeleteRoute(ctx context.Context, id string) error {
+	_, err := c.doRequest(ctx, "DELETE", "/routes/"+id, nil)
+	return err
+}
+func (c *ApisixClient) RegisterProto(ctx context.Context, proto *Proto) error {
+	if proto.ID == "" {
+		return fmt.Errorf("register proto: id is required")
+	}
+	_, err := c.doRequest(ctx, "PUT", "/protos/"+proto.ID, proto)
+	return err
+}
+func (c *ApisixClient) DeleteProto(ctx context.Context, id string) error {
+	_, err := c.doRequest(ctx, "DELETE", "/protos/"+id, nil)
+	return err
+}
+func (c *ApisixClient) RegisterPluginConfig(ctx context.Context, pc *PluginConfig) error {
+	if pc.ID == "" {
+		return fmt.Errorf("register plugin config: id is required")
+	}
+	_, err := c.doRequest(ctx, "PUT", "/plugin_configs/"+pc.ID, pc)
+	return err
+}
+func (c *ApisixClient) DeletePluginConfig(ctx context.Context, id string) error {
+	_, err := c.doRequest(ctx, "DELETE", "/plugin_configs/"+id, nil)
+	return err
+}
+func (c *ApisixClient) RegisterGlobalRule(ctx context.Context, rule *GlobalRule) error {
+	if rule.ID == "" {
+		return fmt.Errorf("register global rule: id is required")
+	}
+	_, err := c.doRequest(ctx, "PUT", "/global_rules/"+rule.ID, rule)
 	return err
 }
-func (c *ApisixClient) DeleteService(id string) error {
-	_, err := c.doRequest("DELETE", "/services/"+id, nil)
+func (c *ApisixClient) DeleteGlobalRule(ctx context.Context, id string) error {
+	_, err := c.doRequest(ctx, "DELETE", "/global_rules/"+id, nil)
 	return err
 }
-func (c *ApisixClient) RegisterRoute(id string, route map[string]interface{}) error {
-	_, err := c.doRequest("PUT", "/routes/"+id, route)
+func (c *ApisixClient) RegisterPluginMetadata(ctx context.Context, name string, metadata map[string]interface{}) error {
+	if name == "" {
+		return fmt.Errorf("register plugin metadata: name is required")
+	}
+	_, err := c.doRequest(ctx, "PUT", "/plugin_metadata/"+name, metadata)
 	return err
 }
-func (c *ApisixClient) DeleteRoute(id string) error {
-	_, err := c.doRequest("DELETE", "/routes/"+id, nil)
+func (c *ApisixClient) DeletePluginMetadata(ctx context.Context, name string) error {
+	_, err := c.doRequest(ctx, "DELETE", "/plugin_metadata/"+name, nil)
 	return err
 }
-func (c *ApisixClient) RegisterProto(id string, protoContent string) error {
-	body := map[string]interface{}{"content": protoContent}
-	_, err := c.doRequest("PUT", "/protos/"+id, body)
+func (c *ApisixClient) RegisterStreamRoute(ctx context.Context, route *StreamRoute) error {
+	if route.ID == "" {
+		return fmt.Errorf("register stream route: id is required")
+	}
+	_, err := c.doRequest(ctx, "PUT", "/stream_routes/"+route.ID, route)
 	return err
 }
-func (c *ApisixClient) DeleteProto(id string) error {
-	_, err := c.doRequest("DELETE", "/protos/"+id, nil)
+func (c *ApisixClient) DeleteStreamRoute(ctx context.Context, id string) error {
+	_, err := c.doRequest(ctx, "DELETE", "/stream_routes/"+id, nil)
 	return err
 }
-func (c *ApisixClient) RegisterUpstream(id string, upstream map[string]interface{}) error {
-	_, err := c.doRequest("PUT", "/upstreams/"+id, upstream)
+
+// sslPath APISIX 2.x 的 SSL 资源路径为 /ssl，3.x 为 /ssls
+func (c *ApisixClient) sslPath(id string) string {
+	if c.isV2() {
+		return "/ssl/" + id
+	}
+	return "/ssls/" + id
+}
+func (c *ApisixClient) RegisterSSL(ctx context.Context, ssl *SSL) error {
+	if ssl.ID == "" {
+		return fmt.Errorf("register ssl: id is required")
+	}
+	_, err := c.doRequest(ctx, "PUT", c.sslPath(ssl.ID), ssl)
 	return err
 }
-func (c *ApisixClient) DeleteUpstream(id string) error {
-	_, err := c.doRequest("DELETE", "/upstreams/"+id, nil)
+func (c *ApisixClient) DeleteSSL(ctx context.Context, id string) error {
+	_, err := c.doRequest(ctx, "DELETE", c.sslPath(id), nil)
+	return err
+}
+func (c *ApisixClient) RegisterUpstream(ctx context.Context, upstream *Upstream) error {
+	if upstream.ID == "" {
+		return fmt.Errorf("register upstream: id is required")
+	}
+	_, err := c.doRequest(ctx, "PUT", "/upstreams/"+upstream.ID, upstream)
+	return err
+}
+func (c *ApisixClient) DeleteUpstream(ctx context.Context, id string) error {
+	_, err := c.doRequest(ctx, "DELETE", "/upstreams/"+id, nil)
+	return err
+}
+func (c *ApisixClient) RegisterConsumer(ctx context.Context, consumer *Consumer) error {
+	if consumer.Username == "" {
+		return fmt.Errorf("register consumer: username is required")
+	}
+	if !c.supportsCredentials() {
+		_, err := c.doRequest(ctx, "PUT", "/consumers/"+consumer.Username, consumer)
+		return err
+	}
+	// APISIX 3.10+：鉴权插件写入 /consumers/{username}/credentials，其余插件保留在 consumer 上
+	base := *consumer
+	base.Plugins = map[string]interface{}{}
+	credentials := map[string]interface{}{}
+	for name, conf := range consumer.Plugins {
+		if authPlugins[name] {
+			credentials[name] = conf
+		} else {
+			base.Plugins[name] = conf
+		}
+	}
+	if _, err := c.doRequest(ctx, "PUT", "/consumers/"+consumer.Username, &base); err != nil {
+		return err
+	}
+	for name, conf := range credentials {
+		path := fmt.Sprintf("/consumers/%s/credentials/%s-%s", consumer.Username, consumer.Username, name)
+		body := map[string]interface{}{"plugins": map[string]interface{}{name: conf}}
+		if _, err := c.doRequest(ctx, "PUT", path, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authPlugins 可作为 consumer credential 的鉴权插件
+var authPlugins = map[string]bool{
+	"key-auth":   true,
+	"jwt-auth":   true,
+	"basic-auth": true,
+	"hmac-auth":  true,
+}
+
+func (c *ApisixClient) DeleteConsumer(ctx context.Context, username string) error {
+	_, err := c.doRequest(ctx, "DELETE", "/consumers/"+username, nil)
 	return err
 }
 
 // RegisterConsumers 自动注册 APISIX Consumer，支持 multi-auth
-func RegisterConsumers(client *ApisixClient, consumers []ConsumerConfig) {
+func RegisterConsumers(ctx context.Context, client *ApisixClient, consumers []ConsumerConfig) {
 	for _, c := range consumers {
-		plugins := map[string]interface{}{}
+		consumer := NewConsumer(c.Name)
 		if c.JwtEnabled {
-			plugins["jwt-auth"] = map[string]interface{}{"key": c.Name}
+			consumer.WithPlugin("jwt-auth", map[string]interface{}{"key": c.Name})
 		}
 		if c.KeyAuthEnabled && c.KeyAuthKey != "" {
-			plugins["key-auth"] = map[string]interface{}{"key": c.KeyAuthKey}
+			consumer.WithPlugin("key-auth", map[string]interface{}{"key": c.KeyAuthKey})
 		}
-		if len(plugins) == 0 {
+		if len(consumer.Plugins) == 0 {
 			log.Printf("[APISIX-AGENT] Consumer %s: no auth plugin enabled, skip", c.Name)
 			continue
 		}
-		consumer := map[string]interface{}{
-			"username": c.Name,
-			"plugins":  plugins,
-		}
-		path := "/consumers/" + c.Name
-		// 幂等注册，已存在则跳过
-		_, err := client.doRequest("PUT", path, consumer)
-		if err != nil {
-			log.Printf("[APISIX-AGENT] RegisterConsumer failed for %s: %v", c.Name, err)
+		// 幂等注册，PUT 覆盖已存在的 consumer
+		if err := client.RegisterConsumer(ctx, consumer); err != nil {
+			log.Printf("[APISIX-AGENT] RegisterConsumer failed: %v", resourceError("consumer", c.Name, err))
 		} else {
 			log.Printf("[APISIX-AGENT] Consumer registered: %s", c.Name)
 		}
@@ -0,0 +1,139 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type countingTransport struct {
+	calls int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestApisixClient_CancelAbortsRetry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	rt := &countingTransport{}
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, MaxRetry: 5, RetryInterval: time.Second}, WithTransport(rt))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := client.DeleteRoute(ctx, "r1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("retry not aborted by context: %v", elapsed)
+	}
+	if rt.calls != 1 {
+		t.Errorf("expected 1 request through injected transport, got %d", rt.calls)
+	}
+}
+
+func TestApisixClient_RetryPolicy(t *testing.T) {
+	var calls int
+	status := http.StatusBadRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "1")
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	// 关闭熔断，单独验证重试策略
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, MaxRetry: 5, RetryInterval: time.Millisecond, BreakerThreshold: -1})
+	ctx := context.Background()
+
+	// 4xx 校验错误不重试
+	if err := client.RegisterRoute(ctx, &Route{ID: "r1"}); err == nil || calls != 1 {
+		t.Errorf("expected single failed attempt on 400, calls=%d err=%v", calls, err)
+	}
+
+	// DELETE 404 视为成功
+	calls, status = 0, http.StatusNotFound
+	if err := client.DeleteRoute(ctx, "r1"); err != nil || calls != 1 {
+		t.Errorf("expected 404 on delete to succeed, calls=%d err=%v", calls, err)
+	}
+
+	// 5xx 重试直到次数用尽
+	calls, status = 0, http.StatusBadGateway
+	if err := client.DeleteRoute(ctx, "r1"); err == nil || calls != 5 {
+		t.Errorf("expected 5 attempts on 502, calls=%d err=%v", calls, err)
+	}
+
+	// Retry-After 超出总预算时立即放弃
+	calls, status = 0, http.StatusServiceUnavailable
+	client.Retry.MaxElapsed = 100 * time.Millisecond
+	start := time.Now()
+	if err := client.DeleteRoute(ctx, "r1"); err == nil || calls != 1 {
+		t.Errorf("expected budget to stop retries, calls=%d err=%v", calls, err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("retry budget not honored: %v", time.Since(start))
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second}
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		d := p.Backoff(attempt)
+		if d < max/2 || d > max {
+			t.Errorf("attempt %d: backoff %v out of [%v, %v]", attempt, d, max/2, max)
+		}
+	}
+	if d := parseRetryAfter("3", time.Now()); d != 3*time.Second {
+		t.Errorf("unexpected Retry-After: %v", d)
+	}
+}
+
+func TestDefaultRetryPolicy_Budget(t *testing.T) {
+	if p := DefaultRetryPolicy(&Config{}); p.MaxElapsed != 2*time.Minute {
+		t.Errorf("expected default retry budget 2m, got %v", p.MaxElapsed)
+	}
+	if p := DefaultRetryPolicy(&Config{RetryMaxElapsed: -1}); p.MaxElapsed != 0 {
+		t.Errorf("expected negative retry_max_elapsed to remove the limit, got %v", p.MaxElapsed)
+	}
+	cfg, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RetryInterval != 3*time.Second {
+		t.Errorf("expected retry_interval clamped to 3s, got %v", cfg.RetryInterval)
+	}
+}
+
+func TestApisixClient_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error_msg":"invalid plugin grpc-transcode: property method is required"}`))
+	}))
+	defer srv.Close()
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, MaxRetry: 3, RetryInterval: time.Millisecond})
+
+	err := resourceError("route", "auth-3", client.RegisterRoute(context.Background(), &Route{ID: "auth-3"}))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *APIError, got %T: %v", err, err)
+	}
+	if apiErr.StatusCode != 400 || apiErr.Method != "PUT" || apiErr.Path != "/routes/auth-3" || apiErr.Attempts != 1 {
+		t.Errorf("unexpected APIError: %+v", apiErr)
+	}
+	want := "route auth-3: invalid plugin grpc-transcode: property method is required (PUT /routes/auth-3: status 400 after 1 attempt)"
+	if err.Error() != want {
+		t.Errorf("unexpected error message:\n got: %s\nwant: %s", err.Error(), want)
+	}
+}
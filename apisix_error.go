@@ -0,0 +1,59 @@
+package apisixregistryagent
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// APIError Admin API 请求失败的详细信息，可通过 errors.As 获取
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int    // 0 表示未收到响应（网络错误）
+	Message    string // APISIX 返回的 error_msg
+	Body       string // 原始响应体
+	Attempts   int
+	Err        error // 底层网络错误
+}
+
+func (e *APIError) Error() string {
+	attempts := "attempt"
+	if e.Attempts != 1 {
+		attempts = "attempts"
+	}
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s %s: %v (after %d %s)", e.Method, e.Path, e.Err, e.Attempts, attempts)
+	}
+	msg := e.Message
+	if msg == "" {
+		msg = e.Body
+	}
+	return fmt.Sprintf("%s (%s %s: status %d after %d %s)", msg, e.Method, e.Path, e.StatusCode, e.Attempts, attempts)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// parseErrorMessage 提取 APISIX 错误响应中的 error_msg（部分插件/鉴权错误使用 message）
+func parseErrorMessage(body []byte) string {
+	var data struct {
+		ErrorMsg string `json:"error_msg"`
+		Message  string `json:"message"`
+	}
+	if json.Unmarshal(body, &data) != nil {
+		return ""
+	}
+	if data.ErrorMsg != "" {
+		return data.ErrorMsg
+	}
+	return data.Message
+}
+
+// resourceError 为错误加上资源类型与 id，例如 "route auth-3: invalid plugin ..."
+func resourceError(kind, id string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s %s: %w", kind, id, err)
+}
@@ -0,0 +1,288 @@
+package apisixregistryagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ListOptions 列表查询参数。Page 为 0 时自动翻页获取全部结果；
+// 过滤条件在 v3 中由服务端处理，v2 不支持时在客户端按相同规则过滤
+type ListOptions struct {
+	Page     int
+	PageSize int
+	Name     string // 名称包含
+	Label    string // "key" 或 "key:value"
+	URI      string // 路由 uri 包含
+}
+
+// maxPageSize APISIX v3 允许的最大 page_size
+const maxPageSize = 500
+
+// adminItem Admin API 单个资源的包装，v2/v3 均为 {key, value}
+type adminItem struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// adminResponse 兼容 v2 与 v3 的响应格式：
+//
+//	v3 get:  {"key": "...", "value": {...}}
+//	v3 list: {"total": 1, "list": [{"key": "...", "value": {...}}]}
+//	v2 get:  {"node": {"key": "...", "value": {...}}}
+//	v2 list: {"node": {"dir": true, "nodes": [{"key": "...", "value": {...}}]}, "count": 1}
+type adminResponse struct {
+	Value json.RawMessage `json:"value"`
+	List  json.RawMessage `json:"list"`
+	Total int             `json:"total"`
+	Node  *struct {
+		Value json.RawMessage `json:"value"`
+		Nodes []adminItem     `json:"nodes"`
+	} `json:"node"`
+}
+
+// IsNotFound 判断错误是否为资源不存在（404）
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// decodeValue 从 get 响应中提取 value
+func decodeValue(body []byte, out interface{}) error {
+	var resp adminResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("decode admin response: %w", err)
+	}
+	value := resp.Value
+	if len(value) == 0 && resp.Node != nil {
+		value = resp.Node.Value
+	}
+	if len(value) == 0 {
+		return fmt.Errorf("decode admin response: missing value")
+	}
+	return json.Unmarshal(value, out)
+}
+
+// decodeList 从 list 响应中提取各资源的 value，并返回服务端给出的总数（v2 为 -1）
+func decodeList(body []byte) ([]json.RawMessage, int, error) {
+	var resp adminResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, 0, fmt.Errorf("decode admin list: %w", err)
+	}
+	var items []adminItem
+	switch {
+	case len(resp.List) > 0:
+		// v3 空列表在部分版本中返回 {} 而不是 []
+		if trimmed := bytes.TrimSpace(resp.List); len(trimmed) > 0 && trimmed[0] == '[' {
+			if err := json.Unmarshal(trimmed, &items); err != nil {
+				return nil, 0, fmt.Errorf("decode admin list: %w", err)
+			}
+		}
+	case resp.Node != nil:
+		items = resp.Node.Nodes
+		resp.Total = -1
+	}
+	values := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		if len(item.Value) > 0 {
+			values = append(values, item.Value)
+		}
+	}
+	return values, resp.Total, nil
+}
+
+// matchListOptions 客户端过滤，与 v3 服务端 name/label/uri 过滤语义一致
+func matchListOptions(value json.RawMessage, opts *ListOptions) bool {
+	if opts == nil || (opts.Name == "" && opts.Label == "" && opts.URI == "") {
+		return true
+	}
+	var v struct {
+		Name   string            `json:"name"`
+		URI    string            `json:"uri"`
+		URIs   []string          `json:"uris"`
+		Labels map[string]string `json:"labels"`
+	}
+	if json.Unmarshal(value, &v) != nil {
+		return false
+	}
+	if opts.Name != "" && !strings.Contains(v.Name, opts.Name) {
+		return false
+	}
+	if opts.Label != "" {
+		key, val, hasVal := strings.Cut(opts.Label, ":")
+		lv, ok := v.Labels[key]
+		if !ok || (hasVal && lv != val) {
+			return false
+		}
+	}
+	if opts.URI != "" {
+		matched := strings.Contains(v.URI, opts.URI)
+		for _, u := range v.URIs {
+			matched = matched || strings.Contains(u, opts.URI)
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *ApisixClient) getResource(ctx context.Context, path string, out interface{}) error {
+	body, err := c.doRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return err
+	}
+	return decodeValue(body, out)
+}
+
+// listResources 查询资源列表；opts.Page 为 0 时按最大 page_size 翻页直到取完
+func (c *ApisixClient) listResources(ctx context.Context, path string, opts *ListOptions) ([]json.RawMessage, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	page, pageSize := opts.Page, opts.PageSize
+	all := page == 0
+	if all {
+		page, pageSize = 1, maxPageSize
+	}
+	// v2 不支持分页，一次返回全部
+	if c.isV2() {
+		page, pageSize, all = 0, 0, false
+	}
+	var result []json.RawMessage
+	for {
+		q := url.Values{}
+		if pageSize > 0 {
+			q.Set("page", strconv.Itoa(page))
+			q.Set("page_size", strconv.Itoa(pageSize))
+		}
+		if opts.Name != "" {
+			q.Set("name", opts.Name)
+		}
+		if opts.Label != "" {
+			q.Set("label", opts.Label)
+		}
+		if opts.URI != "" {
+			q.Set("uri", opts.URI)
+		}
+		p := path
+		if len(q) > 0 {
+			p += "?" + q.Encode()
+		}
+		body, err := c.doRequest(ctx, "GET", p, nil)
+		if err != nil {
+			return nil, err
+		}
+		values, total, err := decodeList(body)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			if matchListOptions(v, opts) {
+				result = append(result, v)
+			}
+		}
+		// v2 不分页（total=-1），v3 取完最后一页后停止
+		if !all || total < 0 || len(values) < pageSize || page*pageSize >= total {
+			return result, nil
+		}
+		page++
+	}
+}
+
+func decodeValues[T any](values []json.RawMessage) ([]*T, error) {
+	out := make([]*T, 0, len(values))
+	for _, v := range values {
+		item := new(T)
+		if err := json.Unmarshal(v, item); err != nil {
+			return nil, fmt.Errorf("decode admin resource: %w", err)
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func listTyped[T any](ctx context.Context, c *ApisixClient, path string, opts *ListOptions) ([]*T, error) {
+	values, err := c.listResources(ctx, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return decodeValues[T](values)
+}
+
+func getTyped[T any](ctx context.Context, c *ApisixClient, path string) (*T, error) {
+	out := new(T)
+	if err := c.getResource(ctx, path, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Route/Service/Upstream/Consumer/Proto 查询接口，资源不存在时返回的错误满足 IsNotFound
+func (c *ApisixClient) GetRoute(ctx context.Context, id string) (*Route, error) {
+	return getTyped[Route](ctx, c, "/routes/"+id)
+}
+func (c *ApisixClient) ListRoutes(ctx context.Context, opts *ListOptions) ([]*Route, error) {
+	return listTyped[Route](ctx, c, "/routes", opts)
+}
+func (c *ApisixClient) GetService(ctx context.Context, id string) (*Service, error) {
+	return getTyped[Service](ctx, c, "/services/"+id)
+}
+func (c *ApisixClient) ListServices(ctx context.Context, opts *ListOptions) ([]*Service, error) {
+	return listTyped[Service](ctx, c, "/services", opts)
+}
+func (c *ApisixClient) GetUpstream(ctx context.Context, id string) (*Upstream, error) {
+	return getTyped[Upstream](ctx, c, "/upstreams/"+id)
+}
+func (c *ApisixClient) ListUpstreams(ctx context.Context, opts *ListOptions) ([]*Upstream, error) {
+	return listTyped[Upstream](ctx, c, "/upstreams", opts)
+}
+func (c *ApisixClient) GetConsumer(ctx context.Context, username string) (*Consumer, error) {
+	return getTyped[Consumer](ctx, c, "/consumers/"+username)
+}
+func (c *ApisixClient) ListConsumers(ctx context.Context, opts *ListOptions) ([]*Consumer, error) {
+	return listTyped[Consumer](ctx, c, "/consumers", opts)
+}
+func (c *ApisixClient) GetProto(ctx context.Context, id string) (*Proto, error) {
+	return getTyped[Proto](ctx, c, "/protos/"+id)
+}
+func (c *ApisixClient) ListProtos(ctx context.Context, opts *ListOptions) ([]*Proto, error) {
+	return listTyped[Proto](ctx, c, "/protos", opts)
+}
+func (c *ApisixClient) GetPluginConfig(ctx context.Context, id string) (*PluginConfig, error) {
+	return getTyped[PluginConfig](ctx, c, "/plugin_configs/"+id)
+}
+func (c *ApisixClient) ListPluginConfigs(ctx context.Context, opts *ListOptions) ([]*PluginConfig, error) {
+	return listTyped[PluginConfig](ctx, c, "/plugin_configs", opts)
+}
+func (c *ApisixClient) GetGlobalRule(ctx context.Context, id string) (*GlobalRule, error) {
+	return getTyped[GlobalRule](ctx, c, "/global_rules/"+id)
+}
+func (c *ApisixClient) ListGlobalRules(ctx context.Context, opts *ListOptions) ([]*GlobalRule, error) {
+	return listTyped[GlobalRule](ctx, c, "/global_rules", opts)
+}
+func (c *ApisixClient) GetPluginMetadata(ctx context.Context, name string) (map[string]interface{}, error) {
+	var metadata map[string]interface{}
+	if err := c.getResource(ctx, "/plugin_metadata/"+name, &metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+func (c *ApisixClient) GetStreamRoute(ctx context.Context, id string) (*StreamRoute, error) {
+	return getTyped[StreamRoute](ctx, c, "/stream_routes/"+id)
+}
+func (c *ApisixClient) ListStreamRoutes(ctx context.Context, opts *ListOptions) ([]*StreamRoute, error) {
+	return listTyped[StreamRoute](ctx, c, "/stream_routes", opts)
+}
+func (c *ApisixClient) GetSSL(ctx context.Context, id string) (*SSL, error) {
+	return getTyped[SSL](ctx, c, c.sslPath(id))
+}
+func (c *ApisixClient) ListSSLs(ctx context.Context, opts *ListOptions) ([]*SSL, error) {
+	return listTyped[SSL](ctx, c, strings.TrimSuffix(c.sslPath(""), "/"), opts)
+}
@@ -0,0 +1,89 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApisixClient_ListRoutesV3Pagination(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("page_size") != "500" || q.Get("label") != "owner:auth" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		var items []string
+		start := 0
+		if q.Get("page") == "2" {
+			start = 500
+		}
+		for i := start; i < start+500 && i < 501; i++ {
+			items = append(items, fmt.Sprintf(`{"key":"/apisix/routes/r%d","value":{"id":"r%d","uri":"/r","labels":{"owner":"auth"}}}`, i, i))
+		}
+		fmt.Fprintf(w, `{"total":501,"list":[%s]}`, strings.Join(items, ","))
+	}))
+	defer srv.Close()
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, MaxRetry: 1, RetryInterval: time.Millisecond})
+	routes, err := client.ListRoutes(context.Background(), &ListOptions{Label: "owner:auth"})
+	if err != nil {
+		t.Fatalf("ListRoutes error: %v", err)
+	}
+	if len(routes) != 501 || routes[500].ID != "r500" {
+		t.Errorf("expected 501 routes across 2 pages, got %d", len(routes))
+	}
+}
+
+func TestApisixClient_ListRoutesV2(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"action":"get","count":2,"node":{"dir":true,"key":"/apisix/routes","nodes":[
+			{"key":"/apisix/routes/a","value":{"id":"a","name":"auth-login","uri":"/v1/login"}},
+			{"key":"/apisix/routes/b","value":{"id":"b","name":"user-get","uri":"/v1/user"}}]}}`)
+	}))
+	defer srv.Close()
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, MaxRetry: 1, RetryInterval: time.Millisecond})
+	routes, err := client.ListRoutes(context.Background(), &ListOptions{Name: "auth"})
+	if err != nil {
+		t.Fatalf("ListRoutes error: %v", err)
+	}
+	if len(routes) != 1 || routes[0].ID != "a" {
+		t.Errorf("expected client-side name filter on v2 response, got %+v", routes)
+	}
+}
+
+func TestApisixClient_GetRoute(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/routes/a":
+			fmt.Fprint(w, `{"key":"/apisix/routes/a","value":{"id":"a","uri":"/v1/login","methods":["POST"]}}`)
+		case "/routes/v2":
+			fmt.Fprint(w, `{"action":"get","node":{"key":"/apisix/routes/v2","value":{"id":"v2","uri":"/v2"}}}`)
+		case "/routes":
+			fmt.Fprint(w, `{"total":0,"list":{}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"Key not found"}`)
+		}
+	}))
+	defer srv.Close()
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, MaxRetry: 3, RetryInterval: time.Millisecond})
+	ctx := context.Background()
+
+	route, err := client.GetRoute(ctx, "a")
+	if err != nil || route.URI != "/v1/login" || route.Methods[0] != "POST" {
+		t.Errorf("unexpected v3 route: %+v, err=%v", route, err)
+	}
+	route, err = client.GetRoute(ctx, "v2")
+	if err != nil || route.URI != "/v2" {
+		t.Errorf("unexpected v2 route: %+v, err=%v", route, err)
+	}
+	if _, err := client.GetRoute(ctx, "missing"); !IsNotFound(err) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+	if routes, err := client.ListRoutes(ctx, nil); err != nil || len(routes) != 0 {
+		t.Errorf("expected empty list, got %+v, err=%v", routes, err)
+	}
+}
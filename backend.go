@@ -0,0 +1,159 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Backend 资源存储后端。默认通过 HTTP 访问 Admin API；standalone（apisix.yaml）与 etcd 后端
+// 按 Admin API 的路径与语义（PUT/PATCH/DELETE/GET 及 v3 响应格式）在本地实现，
+// 因此 ApisixClient 的所有方法无需区分后端
+type Backend interface {
+	Request(ctx context.Context, method, path string, body []byte) ([]byte, error)
+}
+
+// failedBackend 后端或 Admin TLS 配置无效时使用：所有请求直接返回配置错误，不回退到 HTTP Admin API
+type failedBackend struct {
+	err error
+}
+
+func (b failedBackend) Request(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	return nil, b.err
+}
+
+// backendResources Admin API 路径到资源类型（apisix.yaml 段名、etcd key 前缀）的映射
+var backendResources = map[string]string{
+	"routes":          "routes",
+	"services":        "services",
+	"upstreams":       "upstreams",
+	"protos":          "protos",
+	"consumers":       "consumers",
+	"ssls":            "ssls",
+	"ssl":             "ssls",
+	"global_rules":    "global_rules",
+	"plugin_configs":  "plugin_configs",
+	"plugin_metadata": "plugin_metadata",
+	"stream_routes":   "stream_routes",
+}
+
+// parseResourcePath 解析 /routes/1?page=1 为 ("routes", "1")；不支持的路径（如 /schema、consumer credentials）返回 false
+func parseResourcePath(path string) (resource, id string, ok bool) {
+	path, _, _ = strings.Cut(path, "?")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) > 2 {
+		return "", "", false
+	}
+	resource, ok = backendResources[parts[0]]
+	if len(parts) == 2 {
+		id = parts[1]
+	}
+	return resource, id, ok
+}
+
+// resourceKeyField 资源中保存 ID 的字段，consumer 使用 username
+func resourceKeyField(resource string) string {
+	if resource == "consumers" {
+		return "username"
+	}
+	return "id"
+}
+
+// backendError 生成与 Admin API 一致的 *APIError，便于 IsNotFound 等判断
+func backendError(method, path string, status int, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	return &APIError{Method: method, Path: path, StatusCode: status, Message: msg, Attempts: 1}
+}
+
+// unsupportedPath 非 404 的错误，避免 schema 校验把不支持的接口当作未知插件
+func unsupportedPath(backend, method, path string) error {
+	return backendError(method, path, http.StatusNotImplemented, "%s %s is not supported by the %s backend", method, path, backend)
+}
+
+// applyWrite 计算 PUT/PATCH 后的资源值；PATCH 按 JSON merge patch 合并，null 删除字段
+func applyWrite(method, path, resource, id string, current map[string]interface{}, body []byte) (map[string]interface{}, error) {
+	if id == "" {
+		return nil, backendError(method, path, http.StatusBadRequest, "resource id is required")
+	}
+	var value map[string]interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, backendError(method, path, http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	switch method {
+	case "PUT":
+	case "PATCH":
+		if current == nil {
+			return nil, backendError(method, path, http.StatusNotFound, "Key not found")
+		}
+		value = mergePatch(current, value)
+	default:
+		return nil, backendError(method, path, http.StatusMethodNotAllowed, "method not allowed")
+	}
+	value[resourceKeyField(resource)] = id
+	return value, nil
+}
+
+// mergePatch 返回 dst 合并 patch 后的新 map，不修改 dst
+func mergePatch(dst, patch map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(dst))
+	for k, v := range dst {
+		out[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		if pm, ok := v.(map[string]interface{}); ok {
+			if dm, ok := out[k].(map[string]interface{}); ok {
+				out[k] = mergePatch(dm, pm)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// resourceKey APISIX 在 etcd 中的 key（不含前缀），也用于响应中的 key 字段
+func resourceKey(resource, id string) string {
+	return "/" + resource + "/" + id
+}
+
+// itemResponse 生成 v3 格式的单个资源响应
+func itemResponse(prefix, resource, id string, value interface{}) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"key": prefix + resourceKey(resource, id), "value": value})
+}
+
+// listResponse 生成 v3 格式的列表响应，按请求路径中的 page/page_size 分页（与 Admin API 一致，page 从 1 开始）
+func listResponse(path, prefix, resource string, values []map[string]interface{}) ([]byte, error) {
+	total := len(values)
+	if _, rawQuery, ok := strings.Cut(path, "?"); ok {
+		q, _ := url.ParseQuery(rawQuery)
+		if size, err := strconv.Atoi(q.Get("page_size")); err == nil && size > 0 {
+			page, err := strconv.Atoi(q.Get("page"))
+			if err != nil || page < 1 {
+				page = 1
+			}
+			start := (page - 1) * size
+			if start > total {
+				start = total
+			}
+			end := start + size
+			if end > total {
+				end = total
+			}
+			values = values[start:end]
+		}
+	}
+	list := make([]map[string]interface{}, 0, len(values))
+	for _, v := range values {
+		id := fmt.Sprint(v[resourceKeyField(resource)])
+		list = append(list, map[string]interface{}{"key": prefix + resourceKey(resource, id), "value": v})
+	}
+	return json.Marshal(map[string]interface{}{"total": total, "list": list})
+}
@@ -0,0 +1,175 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 熔断器打开期间 Admin API 请求直接失败，不再发出
+var ErrCircuitOpen = errors.New("APISIX Admin API circuit breaker is open")
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常放行
+	BreakerOpen                         // 连续失败达到阈值，快速失败
+	BreakerHalfOpen                     // 冷却结束，放行一个探测请求
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker 连续 threshold 次失败（网络错误、5xx 等）后打开，cooldown 后进入半开状态，
+// 探测成功则关闭，失败则重新打开。nil 表示不启用
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	probeSeq uint64 // 每次放行探测请求递增，用于只释放自己持有的探测名额
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// State 返回当前状态，冷却结束的打开状态视为半开
+func (b *CircuitBreaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Allow 判断是否可以发出请求；半开状态同时只放行一个探测请求
+func (b *CircuitBreaker) Allow() error {
+	_, err := b.acquire()
+	return err
+}
+
+// acquire 与 Allow 相同，另返回 release：请求未记录 Success/Failure 就结束时（如 ctx 取消）
+// 必须调用 release 归还探测名额，否则熔断器会一直停留在半开状态。release 可重复调用
+func (b *CircuitBreaker) acquire() (release func(), err error) {
+	noop := func() {}
+	if b == nil {
+		return noop, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return noop, ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+	case BreakerHalfOpen:
+		if b.probing {
+			return noop, ErrCircuitOpen
+		}
+	default:
+		return noop, nil
+	}
+	b.probing = true
+	b.probeSeq++
+	seq := b.probeSeq
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.probing && b.probeSeq == seq {
+			b.probing = false
+		}
+	}, nil
+}
+
+type noBreakerKey struct{}
+
+// withoutBreaker 返回不经过熔断器的 ctx：反注册是退出前最后一次写入机会，
+// 熔断打开时也要逐个尝试（总耗时由 ctx 的超时限制），而不是全部立即失败留下残留资源
+func withoutBreaker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noBreakerKey{}, true)
+}
+
+// breakerFor 返回本次请求使用的熔断器，nil 表示不经过熔断器
+func (c *ApisixClient) breakerFor(ctx context.Context) *CircuitBreaker {
+	if ctx.Value(noBreakerKey{}) != nil {
+		return nil
+	}
+	return c.Breaker
+}
+
+// Success 记录一次成功，关闭熔断器
+func (b *CircuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state, b.failures, b.probing = BreakerClosed, 0, false
+}
+
+// Failure 记录一次失败，返回熔断器是否因此打开
+func (b *CircuitBreaker) Failure() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// Wait 熔断器打开时阻塞到冷却结束，用于在 Admin API 不可用时整体退避
+func (b *CircuitBreaker) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	var wait time.Duration
+	if b.state == BreakerOpen {
+		wait = b.cooldown - time.Since(b.openedAt)
+	}
+	b.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
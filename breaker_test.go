@@ -0,0 +1,171 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_States(t *testing.T) {
+	b := NewCircuitBreaker(2, 20*time.Millisecond)
+	b.Failure()
+	if b.State() != BreakerClosed || b.Allow() != nil {
+		t.Fatal("expected breaker closed below threshold")
+	}
+	if !b.Failure() || b.State() != BreakerOpen {
+		t.Fatal("expected breaker open at threshold")
+	}
+	if !errors.Is(b.Allow(), ErrCircuitOpen) {
+		t.Error("expected fail fast while open")
+	}
+	time.Sleep(25 * time.Millisecond)
+	if b.State() != BreakerHalfOpen {
+		t.Errorf("expected half-open after cooldown, got %s", b.State())
+	}
+	if b.Allow() != nil {
+		t.Fatal("expected one probe allowed")
+	}
+	if !errors.Is(b.Allow(), ErrCircuitOpen) {
+		t.Error("expected concurrent probe rejected")
+	}
+	// 探测失败重新打开
+	if !b.Failure() || b.State() != BreakerOpen {
+		t.Fatal("expected breaker reopened after failed probe")
+	}
+	time.Sleep(25 * time.Millisecond)
+	b.Allow()
+	b.Success()
+	if b.State() != BreakerClosed {
+		t.Errorf("expected closed after successful probe, got %s", b.State())
+	}
+}
+
+func TestApisixClient_CircuitBreaker(t *testing.T) {
+	calls, status := 0, http.StatusBadGateway
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, MaxRetry: 5, RetryInterval: time.Millisecond,
+		BreakerThreshold: 3, BreakerCooldown: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	// 第三次失败后熔断，剩余重试不再发出
+	if err := client.DeleteRoute(ctx, "r1"); !errors.Is(err, ErrCircuitOpen) || calls != 3 {
+		t.Fatalf("expected breaker to stop retries after 3 calls, calls=%d err=%v", calls, err)
+	}
+	if client.BreakerState() != BreakerOpen {
+		t.Errorf("expected open state, got %s", client.BreakerState())
+	}
+	if err := client.DeleteRoute(ctx, "r2"); !errors.Is(err, ErrCircuitOpen) || calls != 3 {
+		t.Errorf("expected fail fast while open, calls=%d err=%v", calls, err)
+	}
+
+	status = http.StatusOK
+	if err := client.Breaker.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteRoute(ctx, "r3"); err != nil || calls != 4 {
+		t.Errorf("expected half-open probe to succeed, calls=%d err=%v", calls, err)
+	}
+	if client.BreakerState() != BreakerClosed {
+		t.Errorf("expected closed state, got %s", client.BreakerState())
+	}
+}
+
+func TestApisixClient_CircuitBreakerProbeCancelled(t *testing.T) {
+	var block atomic.Bool
+	block.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if block.Load() {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, MaxRetry: 1, BreakerThreshold: 1, BreakerCooldown: 10 * time.Millisecond})
+	client.Breaker.Failure()
+	time.Sleep(15 * time.Millisecond)
+
+	// 半开探测请求因 ctx 取消而结束，不应占住探测名额
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.DeleteRoute(ctx, "r1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if client.BreakerState() != BreakerHalfOpen {
+		t.Errorf("expected half-open after cancelled probe, got %s", client.BreakerState())
+	}
+	block.Store(false)
+	if err := client.DeleteRoute(context.Background(), "r2"); err != nil {
+		t.Fatalf("expected next probe allowed, got %v", err)
+	}
+	if client.BreakerState() != BreakerClosed {
+		t.Errorf("expected closed after successful probe, got %s", client.BreakerState())
+	}
+}
+
+func TestRunContext_DeregisterWithBreakerOpen(t *testing.T) {
+	var mu sync.Mutex
+	var deletes []string
+	registered := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			http.NotFound(w, r)
+			return
+		case "DELETE":
+			mu.Lock()
+			deletes = append(deletes, r.URL.Path)
+			mu.Unlock()
+		case "PUT":
+			if strings.HasPrefix(r.URL.Path, "/apisix/admin/services/") {
+				select {
+				case registered <- struct{}{}:
+				default:
+				}
+			}
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	breaker := NewCircuitBreaker(1, time.Hour)
+	cfg := &Config{AdminAPI: srv.URL + "/apisix/admin", ApisixVersion: "3.9.0", ServiceID: "auth", ServicePort: 8082, MaxRetry: 1,
+		Upstream: &UpstreamSpec{Nodes: map[string]int{"10.0.0.1:8082": 1}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- RunContext(ctx, cfg, func(c *ApisixClient) { c.Breaker = breaker })
+	}()
+	select {
+	case <-registered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("service not registered")
+	}
+	time.Sleep(50 * time.Millisecond) // 等待 PUT 响应返回，注册流程进入等待退出
+	// 退出前 Admin API 曾连续失败，熔断器处于打开状态且冷却远未结束
+	breaker.Failure()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, want := range []string{"/apisix/admin/services/auth", "/apisix/admin/upstreams/auth"} {
+		found := false
+		for _, p := range deletes {
+			found = found || p == want
+		}
+		if !found {
+			t.Errorf("expected DELETE %s despite open breaker, got %v", want, deletes)
+		}
+	}
+}
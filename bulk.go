@@ -0,0 +1,119 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultConcurrency 批量写入默认并发数
+const defaultConcurrency = 4
+
+// BulkTask 批量写入中的一个独立操作，例如写入一条路由
+type BulkTask struct {
+	Kind string
+	ID   string
+	Do   func(ctx context.Context) error
+}
+
+// BulkError 汇总批量写入中失败的操作
+type BulkError struct {
+	Errors []error
+}
+
+func (e *BulkError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d operations failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+func (e *BulkError) Unwrap() []error {
+	return e.Errors
+}
+
+// RunBulk 使用最多 concurrency 个 worker 执行相互独立的操作，全部完成后返回；
+// 有依赖关系的资源应分批调用（如先 upstream/service，再 routes）。
+// 失败的操作汇总为 *BulkError，ctx 取消后未开始的操作不再执行
+func RunBulk(ctx context.Context, concurrency int, tasks []BulkTask) error {
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(tasks)) // 每个 worker 只写自己的下标
+		sem  = make(chan struct{}, concurrency)
+	)
+	for i, task := range tasks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = resourceError(task.Kind, task.ID, ctx.Err())
+			continue
+		}
+		wg.Add(1)
+		go func(i int, task BulkTask) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := task.Do(ctx); err != nil {
+				errs[i] = resourceError(task.Kind, task.ID, err)
+			}
+		}(i, task)
+	}
+	wg.Wait()
+	// 按任务顺序输出，便于对照日志
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &BulkError{Errors: failed}
+}
+
+// rateLimiter 按固定间隔放行请求（QPS 限制），由所有 worker 共享
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newRateLimiter(qps float64) *rateLimiter {
+	if qps <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / qps)}
+}
+
+// Wait 阻塞到下一个可用时间点；nil 表示不限速
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
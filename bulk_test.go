@@ -0,0 +1,72 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunBulk_ConcurrencyAndErrors(t *testing.T) {
+	var running, peak int32
+	errBoom := errors.New("boom")
+	var tasks []BulkTask
+	for i := 0; i < 20; i++ {
+		tasks = append(tasks, BulkTask{Kind: "route", ID: fmt.Sprintf("r%d", i), Do: func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			if i%7 == 0 {
+				return errBoom
+			}
+			return nil
+		}})
+	}
+	err := RunBulk(context.Background(), 3, tasks)
+	if peak > 3 {
+		t.Errorf("expected at most 3 concurrent tasks, got %d", peak)
+	}
+	var be *BulkError
+	if !errors.As(err, &be) || len(be.Errors) != 3 {
+		t.Fatalf("expected 3 aggregated errors, got %v", err)
+	}
+	if !errors.Is(err, errBoom) {
+		t.Error("expected aggregated error to wrap task errors")
+	}
+	if want := "route r0: boom"; be.Errors[0].Error() != want {
+		t.Errorf("expected first error %q, got %q", want, be.Errors[0].Error())
+	}
+}
+
+func TestApisixClient_QPSLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, QPS: 50})
+	var tasks []BulkTask
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("r%d", i)
+		tasks = append(tasks, BulkTask{Kind: "route", ID: id, Do: func(ctx context.Context) error {
+			return client.DeleteRoute(ctx, id)
+		}})
+	}
+	start := time.Now()
+	if err := RunBulk(context.Background(), 10, tasks); err != nil {
+		t.Fatal(err)
+	}
+	// 10 个请求在 50 QPS 下至少需要 9 个间隔（180ms）
+	if elapsed := time.Since(start); elapsed < 170*time.Millisecond {
+		t.Errorf("expected requests to be rate limited, took %v", elapsed)
+	}
+}
@@ -0,0 +1,186 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// VersionedUpstreamID 生成按版本区分的 upstream id，例如 auth-v1.0.1
+func VersionedUpstreamID(serviceID, version string) string {
+	if version == "" {
+		return serviceID
+	}
+	return serviceID + "-" + version
+}
+
+// canaryActive 判断当前实例是否以金丝雀版本运行（版本与稳定版本不同）
+func canaryActive(cfg *Config) bool {
+	return cfg.Canary != nil && cfg.Canary.Enabled && cfg.ServiceVersion != "" &&
+		cfg.Canary.StableVersion != "" && cfg.Canary.StableVersion != cfg.ServiceVersion
+}
+
+// upstreamIDFor 返回当前实例注册的 upstream id
+func upstreamIDFor(cfg *Config, serviceID string) string {
+	if cfg.Canary != nil && cfg.Canary.Enabled {
+		return VersionedUpstreamID(serviceID, cfg.ServiceVersion)
+	}
+	return serviceID
+}
+
+// serviceUpstreamIDFor 返回 service 默认指向的 upstream id（金丝雀模式下为稳定版本）
+func serviceUpstreamIDFor(cfg *Config, serviceID string) string {
+	if canaryActive(cfg) {
+		return VersionedUpstreamID(serviceID, cfg.Canary.StableVersion)
+	}
+	return upstreamIDFor(cfg, serviceID)
+}
+
+// BuildTrafficSplit 生成 traffic-split 插件配置：match 规则命中的流量全部进入新版本，
+// 其余流量按 weight 在新版本与 service 默认 upstream 之间分配
+func BuildTrafficSplit(spec *CanarySpec, canaryUpstreamID string) (map[string]interface{}, error) {
+	if spec.Weight < 0 || spec.Weight > 100 {
+		return nil, fmt.Errorf("canary weight must be between 0 and 100, got %d", spec.Weight)
+	}
+	var rules []interface{}
+	if len(spec.Match) > 0 {
+		var match []interface{}
+		for _, m := range spec.Match {
+			match = append(match, map[string]interface{}{"vars": m.Vars})
+		}
+		rules = append(rules, map[string]interface{}{
+			"match": match,
+			"weighted_upstreams": []interface{}{
+				map[string]interface{}{"upstream_id": canaryUpstreamID, "weight": 1},
+			},
+		})
+	}
+	if spec.Weight > 0 {
+		rules = append(rules, map[string]interface{}{
+			"weighted_upstreams": []interface{}{
+				map[string]interface{}{"upstream_id": canaryUpstreamID, "weight": spec.Weight},
+				// 不带 upstream_id 的条目表示 service 默认 upstream
+				map[string]interface{}{"weight": 100 - spec.Weight},
+			},
+		})
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("canary requires weight > 0 or at least one match rule")
+	}
+	return map[string]interface{}{"rules": rules}, nil
+}
+
+// PromoteCanary 将 service 切换到指定版本 upstream 并移除 traffic-split，随后删除原稳定版本 upstream
+func PromoteCanary(ctx context.Context, client *ApisixClient, serviceID, version string) error {
+	upstreamID := VersionedUpstreamID(serviceID, version)
+	svc, err := client.GetService(ctx, serviceID)
+	if err != nil {
+		return fmt.Errorf("promote %s: %w", upstreamID, err)
+	}
+	patch := map[string]interface{}{
+		"upstream_id": upstreamID,
+		// PATCH 时值为 null 表示删除该字段
+		"plugins": map[string]interface{}{"traffic-split": nil},
+	}
+	if err := client.PatchService(ctx, serviceID, patch); err != nil {
+		return fmt.Errorf("promote %s: %w", upstreamID, err)
+	}
+	log.Printf("[APISIX-AGENT] Canary promoted: service %s -> upstream %s", serviceID, upstreamID)
+	if old := svc.UpstreamID; old != "" && old != upstreamID {
+		if err := client.DeleteUpstream(ctx, old); err != nil && !IsNotFound(err) {
+			log.Printf("[APISIX-AGENT][Warn] Retire upstream %s failed: %v", old, err)
+		} else {
+			log.Printf("[APISIX-AGENT] Previous stable upstream retired: %s", old)
+		}
+	}
+	return nil
+}
+
+// RollbackCanary 移除 traffic-split 并删除金丝雀版本 upstream，流量回到稳定版本；
+// 该版本已被 promote（service 指向它）时不做任何修改
+func RollbackCanary(ctx context.Context, client *ApisixClient, serviceID, version string) error {
+	upstreamID := VersionedUpstreamID(serviceID, version)
+	svc, err := client.GetService(ctx, serviceID)
+	if err != nil && !IsNotFound(err) {
+		return fmt.Errorf("rollback %s: %w", upstreamID, err)
+	}
+	if err == nil {
+		if svc.UpstreamID == upstreamID {
+			log.Printf("[APISIX-AGENT] Canary %s already promoted, service %s unchanged", upstreamID, serviceID)
+			return nil
+		}
+		patch := map[string]interface{}{
+			"plugins": map[string]interface{}{"traffic-split": nil},
+		}
+		if err := client.PatchService(ctx, serviceID, patch); err != nil {
+			return fmt.Errorf("rollback %s: %w", upstreamID, err)
+		}
+	}
+	if err := client.DeleteUpstream(ctx, upstreamID); err != nil && !IsNotFound(err) {
+		return fmt.Errorf("rollback delete upstream %s: %w", upstreamID, err)
+	}
+	log.Printf("[APISIX-AGENT] Canary rolled back: service %s, upstream %s removed", serviceID, upstreamID)
+	return nil
+}
+
+// servedByOther 判断 service 是否已切换到其他 upstream（如新版本已 promote），
+// 此时 route/service 等共享资源由新版本使用，本实例退出时不应删除
+func servedByOther(ctx context.Context, client *ApisixClient, serviceID, upstreamID string) (string, bool) {
+	svc, err := client.GetService(ctx, serviceID)
+	if err != nil {
+		if !IsNotFound(err) {
+			log.Printf("[APISIX-AGENT][Warn] GetService %s before deregistration: %v", serviceID, err)
+		}
+		return "", false
+	}
+	if svc.UpstreamID != "" && svc.UpstreamID != upstreamID {
+		return svc.UpstreamID, true
+	}
+	return "", false
+}
+
+// existingService 注册前读取网关上已有的 service，不存在或读取失败时返回 nil。
+// 启用金丝雀时，若 service 已指向另一个仍存在的版本 upstream（该版本已 promote），返回错误：
+// 按过期的 stable_version 写入会让 service 指回 promote 时已删除的 upstream
+func existingService(ctx context.Context, client *ApisixClient, cfg *Config, serviceID string) (*Service, error) {
+	svc, err := client.GetService(ctx, serviceID)
+	if err != nil {
+		if !IsNotFound(err) {
+			log.Printf("[APISIX-AGENT][Warn] GetService %s before registration: %v", serviceID, err)
+		}
+		return nil, nil
+	}
+	if cfg.Canary == nil || !cfg.Canary.Enabled {
+		return svc, nil
+	}
+	target := serviceUpstreamIDFor(cfg, serviceID)
+	if svc.UpstreamID == "" || svc.UpstreamID == target {
+		return svc, nil
+	}
+	if _, err := client.GetUpstream(ctx, svc.UpstreamID); err != nil {
+		// service 指向的 upstream 已不存在，属于残留配置，可以覆盖
+		if !IsNotFound(err) {
+			log.Printf("[APISIX-AGENT][Warn] GetUpstream %s before registration: %v", svc.UpstreamID, err)
+		}
+		return svc, nil
+	}
+	return nil, fmt.Errorf("service %s is served by upstream %s (promoted), refusing to point it back at %s: update canary.stable_version (currently %q)",
+		serviceID, svc.UpstreamID, target, cfg.Canary.StableVersion)
+}
+
+// keepTrafficSplit 非金丝雀实例（稳定版本重启、扩容）写入 service 时保留金丝雀实例设置的 traffic-split，
+// 否则整体 PUT 会中断正在进行的金丝雀分流
+func keepTrafficSplit(existing, svc *Service) bool {
+	if existing == nil {
+		return false
+	}
+	split, ok := existing.Plugins["traffic-split"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if _, ok := svc.Plugins["traffic-split"]; ok {
+		return false
+	}
+	svc.WithPlugin("traffic-split", split)
+	return true
+}
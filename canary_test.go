@@ -0,0 +1,162 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildTrafficSplit(t *testing.T) {
+	spec := &CanarySpec{
+		Enabled:       true,
+		StableVersion: "v1.0.0",
+		Weight:        10,
+		Match:         []CanaryRule{{Vars: [][]interface{}{{"http_x-canary", "==", "true"}}}},
+	}
+	split, err := BuildTrafficSplit(spec, "auth-v1.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rules := split["rules"].([]interface{})
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+	if _, ok := rules[0].(map[string]interface{})["match"]; !ok {
+		t.Errorf("expected first rule to be header match: %+v", rules[0])
+	}
+	weighted := rules[1].(map[string]interface{})["weighted_upstreams"].([]interface{})
+	canary := weighted[0].(map[string]interface{})
+	stable := weighted[1].(map[string]interface{})
+	if canary["upstream_id"] != "auth-v1.0.1" || canary["weight"] != 10 || stable["weight"] != 90 {
+		t.Errorf("unexpected weighted_upstreams: %+v", weighted)
+	}
+
+	if _, err := BuildTrafficSplit(&CanarySpec{Weight: 120}, "auth-v1.0.1"); err == nil {
+		t.Errorf("expected error for weight > 100")
+	}
+}
+
+func TestCanaryUpstreamIDs(t *testing.T) {
+	cfg := &Config{
+		ServiceVersion: "v1.0.1",
+		Canary:         &CanarySpec{Enabled: true, StableVersion: "v1.0.0", Weight: 5},
+	}
+	if got := upstreamIDFor(cfg, "auth"); got != "auth-v1.0.1" {
+		t.Errorf("unexpected upstream id: %s", got)
+	}
+	if got := serviceUpstreamIDFor(cfg, "auth"); got != "auth-v1.0.0" {
+		t.Errorf("unexpected service upstream id: %s", got)
+	}
+	cfg.Canary.StableVersion = "v1.0.1"
+	if canaryActive(cfg) {
+		t.Errorf("stable version instance should not be canary")
+	}
+	if got := serviceUpstreamIDFor(cfg, "auth"); got != "auth-v1.0.1" {
+		t.Errorf("unexpected service upstream id: %s", got)
+	}
+}
+
+func TestPromoteAndRollbackCanary(t *testing.T) {
+	ctx := context.Background()
+	client := NewApisixClient(&Config{Backend: "standalone", Standalone: &StandaloneSpec{Path: filepath.Join(t.TempDir(), "apisix.yaml")}})
+	for _, id := range []string{"auth-v1", "auth-v2"} {
+		if err := client.RegisterUpstream(ctx, &Upstream{ID: id, Type: "roundrobin", Nodes: map[string]int{"10.0.0.1:8082": 1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := NewService("auth", "auth", "auth-v1").WithPlugin("traffic-split", map[string]interface{}{"rules": []interface{}{}})
+	if err := client.RegisterService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PromoteCanary(ctx, client, "auth", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.GetService(ctx, "auth")
+	if err != nil || got.UpstreamID != "auth-v2" || got.Plugins["traffic-split"] != nil {
+		t.Fatalf("expected service promoted to auth-v2, got %+v err=%v", got, err)
+	}
+	if _, err := client.GetUpstream(ctx, "auth-v1"); !IsNotFound(err) {
+		t.Errorf("expected previous stable upstream retired, got %v", err)
+	}
+	// 旧版本实例退出时不应删除共享资源
+	if current, ok := servedByOther(ctx, client, "auth", "auth-v1"); !ok || current != "auth-v2" {
+		t.Errorf("expected service served by auth-v2, got %q %v", current, ok)
+	}
+
+	// 已 promote 的版本回滚时不做修改
+	if err := RollbackCanary(ctx, client, "auth", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetUpstream(ctx, "auth-v2"); err != nil {
+		t.Errorf("expected promoted upstream kept, got %v", err)
+	}
+}
+
+func TestRunContext_StableRestartDuringCanary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apisix.yaml")
+	cfg := &Config{
+		Backend:        "standalone",
+		Standalone:     &StandaloneSpec{Path: path},
+		ServiceID:      "auth",
+		ServicePort:    8082,
+		ServiceVersion: "v1",
+		MaxRetry:       1,
+		Upstream:       &UpstreamSpec{Nodes: map[string]int{"10.0.0.1:8082": 1}},
+		Canary:         &CanarySpec{Enabled: true, StableVersion: "v1", Weight: 10},
+	}
+	ctx := context.Background()
+	client := NewApisixClient(cfg)
+	// 金丝雀 v2 正在运行：service 指向 v1 并通过 traffic-split 分流到 v2
+	split, _ := BuildTrafficSplit(cfg.Canary, "auth-v2")
+	for _, id := range []string{"auth-v1", "auth-v2"} {
+		if err := client.RegisterUpstream(ctx, &Upstream{ID: id, Type: "roundrobin", Nodes: map[string]int{"10.0.0.2:8082": 1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	running := NewService("auth", "auth", "auth-v1").WithPlugin("traffic-split", split)
+	running.Labels = map[string]string{"written_by": "canary"}
+	if err := client.RegisterService(ctx, running); err != nil {
+		t.Fatal(err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- RunContext(runCtx, cfg) }()
+	var got *Service
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if svc, err := client.GetService(ctx, "auth"); err == nil && svc.Labels["written_by"] == "" {
+			got = svc
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("service not re-registered by stable instance")
+		}
+	}
+	if got.UpstreamID != "auth-v1" || got.Plugins["traffic-split"] == nil {
+		t.Errorf("expected stable restart to keep traffic-split on auth-v1, got %+v", got)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// v2 已 promote 后，以过期 stable_version 启动的实例拒绝把 service 指回 v1
+	promoted := NewService("auth", "auth", "auth-v2")
+	if err := client.RegisterService(ctx, promoted); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RegisterUpstream(ctx, &Upstream{ID: "auth-v2", Type: "roundrobin", Nodes: map[string]int{"10.0.0.2:8082": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	err := RunContext(ctx, cfg)
+	if err == nil || !strings.Contains(err.Error(), "promoted") {
+		t.Fatalf("expected stale stable_version rejected, got %v", err)
+	}
+	if svc, _ := client.GetService(ctx, "auth"); svc == nil || svc.UpstreamID != "auth-v2" {
+		t.Errorf("expected service kept on auth-v2, got %+v", svc)
+	}
+}
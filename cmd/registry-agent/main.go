@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	apisixagent "github.com/cncap/apisix-registry-agent"
 )
 
 func main() {
+	// 子命令: promote / rollback 用于金丝雀发布的切换与回滚
+	command := ""
+	if len(os.Args) > 1 && (os.Args[1] == "promote" || os.Args[1] == "rollback") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
 	var (
 		configPath              = flag.String("config", "./registry-config.yaml", "Path to registry-config.yaml config file")
 		env                     = flag.String("env", "dev", "Environment: dev or prod")
@@ -17,6 +26,7 @@ func main() {
 		discoveryType           = flag.String("discovery-type", "", "Discovery type: dns, kubernetes, ...")
 		staticNode              = flag.String("static-node", "", "Static node for upstream, e.g. host:port=1")
 		serviceNameForDiscovery = flag.String("discovery-service-name", "", "Service name for discovery")
+		version                 = flag.String("version", "", "Service version for promote/rollback (default: service_version in config)")
 	)
 	flag.Parse()
 
@@ -44,11 +54,39 @@ func main() {
 	if err != nil {
 		log.Fatalf("[APISIX-AGENT] Failed to load config: %v", err)
 	}
+	if command != "" {
+		if err := runCanaryCommand(cfg, command, *version); err != nil {
+			log.Fatalf("[APISIX-AGENT] %s failed: %v", command, err)
+		}
+		return
+	}
 	if len(staticNodes) > 0 {
 		if cfg.Upstream == nil {
 			cfg.Upstream = &apisixagent.UpstreamSpec{}
 		}
 		cfg.Upstream.Nodes = staticNodes
 	}
-	apisixagent.Run(cfg)
+	if err := apisixagent.Run(cfg); err != nil {
+		log.Fatalf("[APISIX-AGENT] %v", err)
+	}
+}
+
+func runCanaryCommand(cfg *apisixagent.Config, command, version string) error {
+	if version == "" {
+		version = cfg.ServiceVersion
+	}
+	if version == "" {
+		return fmt.Errorf("version is required (--version or service_version)")
+	}
+	serviceID := cfg.ServiceID
+	if serviceID == "" {
+		serviceID = cfg.ServiceName
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	client := apisixagent.NewApisixClient(cfg)
+	if command == "promote" {
+		return apisixagent.PromoteCanary(ctx, client, serviceID, version)
+	}
+	return apisixagent.RollbackCanary(ctx, client, serviceID, version)
 }
@@ -1,10 +1,12 @@
 package apisixregistryagent
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -16,8 +18,69 @@ type PluginSpec struct {
 }
 
 type UpstreamSpec struct {
-	Type  string         `yaml:"type"`
-	Nodes map[string]int `yaml:"nodes"`
+	Type   string           `yaml:"type"`
+	Nodes  map[string]int   `yaml:"nodes"`
+	Scheme string           `yaml:"scheme"` // http/https/grpc/grpcs，默认 grpc
+	TLS    *UpstreamTLSSpec `yaml:"tls,omitempty"`
+	Source *NodeSourceSpec  `yaml:"source,omitempty"` // 由 agent 持续同步 nodes 的节点来源
+}
+
+// NodeSourceSpec 上游节点来源配置，适用于 APISIX 无法直接访问注册中心的场景
+type NodeSourceSpec struct {
+	Type       string                `yaml:"type"` // kubernetes/consul/nacos/file
+	Kubernetes *KubernetesSourceSpec `yaml:"kubernetes,omitempty"`
+	Consul     *ConsulSourceSpec     `yaml:"consul,omitempty"`
+	Nacos      *NacosSourceSpec      `yaml:"nacos,omitempty"`
+	File       *FileSourceSpec       `yaml:"file,omitempty"`
+}
+
+// FileSourceSpec 从 Prometheus file_sd 格式的 JSON/YAML 文件读取节点，轮询监听变化
+type FileSourceSpec struct {
+	Path         string        `yaml:"path"`
+	PollInterval time.Duration `yaml:"poll_interval"` // 默认 5s
+}
+
+// ConsulSourceSpec 通过 Consul health API 查询健康实例，使用 blocking query 监听变化
+type ConsulSourceSpec struct {
+	Address    string        `yaml:"address"` // 例如 http://consul:8500
+	Service    string        `yaml:"service"`
+	Datacenter string        `yaml:"datacenter"`
+	Tag        string        `yaml:"tag"`
+	Token      string        `yaml:"token"`
+	WaitTime   time.Duration `yaml:"wait_time"` // blocking query 最长等待时间，默认 5m
+}
+
+// NacosSourceSpec 通过 Nacos naming open API 查询实例，轮询监听变化
+type NacosSourceSpec struct {
+	Address      string        `yaml:"address"` // 例如 http://nacos:8848
+	Service      string        `yaml:"service"`
+	Namespace    string        `yaml:"namespace"`
+	Group        string        `yaml:"group"`
+	Clusters     string        `yaml:"clusters"`
+	Username     string        `yaml:"username"`
+	Password     string        `yaml:"password"`
+	PollInterval time.Duration `yaml:"poll_interval"` // 默认 10s
+}
+
+// KubernetesSourceSpec 通过 Kubernetes API 监听 Service 的 EndpointSlice
+type KubernetesSourceSpec struct {
+	APIServer string `yaml:"api_server"` // 默认使用集群内地址 KUBERNETES_SERVICE_HOST/PORT
+	Namespace string `yaml:"namespace"`  // 默认 default
+	Service   string `yaml:"service"`
+	PortName  string `yaml:"port_name"` // 按名称选择端口，优先于 port
+	Port      int    `yaml:"port"`      // 未设置 port_name 时使用，均为空则取第一个端口
+	Weight    int    `yaml:"weight"`    // 节点权重，默认 1
+	TokenFile string `yaml:"token_file"`
+	CAFile    string `yaml:"ca_file"`
+}
+
+// UpstreamTLSSpec 上游 TLS/mTLS 配置，证书内容从文件读取
+type UpstreamTLSSpec struct {
+	ClientCert   string `yaml:"client_cert"`    // 客户端证书文件路径
+	ClientKey    string `yaml:"client_key"`     // 客户端私钥文件路径
+	ClientCertID string `yaml:"client_cert_id"` // 引用 APISIX 中已有的 SSL 对象，与 client_cert/client_key 互斥
+	SNI          string `yaml:"sni"`            // 上游 SNI，通过 pass_host=rewrite + upstream_host 实现
+	Verify       *bool  `yaml:"verify"`         // 是否校验上游证书
 }
 
 type ConsumerConfig struct {
@@ -27,32 +90,201 @@ type ConsumerConfig struct {
 	KeyAuthKey     string `yaml:"key_auth_key"`
 }
 
+// CanarySpec 金丝雀/蓝绿发布配置，基于 service_version 生成按版本区分的 upstream
+type CanarySpec struct {
+	Enabled       bool         `yaml:"enabled"`
+	StableVersion string       `yaml:"stable_version"` // 当前稳定版本，service 默认指向该版本 upstream
+	Weight        int          `yaml:"weight"`         // 新版本流量权重（0-100）
+	Match         []CanaryRule `yaml:"match"`          // 按请求头等条件匹配的流量全部转发到新版本
+}
+
+// CanaryRule 对应 traffic-split 的 match.vars 表达式
+type CanaryRule struct {
+	Vars [][]interface{} `yaml:"vars"`
+}
+
 type RouteConfig struct {
-	URI     string       `yaml:"uri"`
-	Methods []string     `yaml:"methods"`
+	URI            string       `yaml:"uri"`
+	URIs           []string     `yaml:"uris"` // 同一路由额外匹配的 uri
+	Methods        []string     `yaml:"methods"`
+	Plugins        []PluginSpec `yaml:"plugins"`
+	PluginConfig   string       `yaml:"plugin_config"` // 引用 plugin_configs 中的 ID
+	RouteMatchSpec `yaml:",inline"`
+}
+
+// RouteMatchSpec 路由匹配与行为选项，用于 routes[] 与 route_defaults（proto 路由及未设置的自定义路由字段）
+type RouteMatchSpec struct {
+	Hosts           []string      `yaml:"hosts"`
+	Vars            []interface{} `yaml:"vars"` // lua-resty-expr 表达式，例如 [["http_x_env", "==", "prod"]]
+	Priority        int           `yaml:"priority"`
+	RemoteAddrs     []string      `yaml:"remote_addrs"`
+	FilterFunc      string        `yaml:"filter_func"`
+	Timeout         *TimeoutSpec  `yaml:"timeout,omitempty"`
+	EnableWebsocket *bool         `yaml:"enable_websocket,omitempty"` // 显式 false 可关闭 route_defaults 中的设置
+	Status          *int          `yaml:"status,omitempty"`           // 1 启用，0 禁用
+}
+
+// TimeoutSpec 路由到上游的超时（秒），APISIX 要求三项同时设置，未设置的项取 route_defaults 或默认 60 秒
+type TimeoutSpec struct {
+	Connect float64 `yaml:"connect"`
+	Send    float64 `yaml:"send"`
+	Read    float64 `yaml:"read"`
+}
+
+// ServiceSpec service 级属性，插件对该 service 下的所有路由生效（路由中同名插件优先）
+type ServiceSpec struct {
+	Desc            string            `yaml:"desc"`
+	Plugins         []PluginSpec      `yaml:"plugins"`
+	Hosts           []string          `yaml:"hosts"`
+	EnableWebsocket bool              `yaml:"enable_websocket"`
+	Labels          map[string]string `yaml:"labels"`
+}
+
+// GlobalRuleSpec 全局规则，写入 /global_rules/{service_id}.{id}
+type GlobalRuleSpec struct {
+	ID      string       `yaml:"id"`
 	Plugins []PluginSpec `yaml:"plugins"`
 }
 
+// PluginMetadataSpec 插件元数据，写入 /plugin_metadata/{name}，为所有使用该插件的路由共享
+type PluginMetadataSpec struct {
+	Name     string                 `yaml:"name"`
+	Config   map[string]interface{} `yaml:"config"`
+	Override bool                   `yaml:"override"` // 与网关中已有的值不一致时仍覆盖
+}
+
+// StreamRouteSpec 四层（TCP/UDP）路由，写入 /stream_routes，需在 APISIX 中开启 stream proxy
+type StreamRouteSpec struct {
+	ID         string              `yaml:"id"` // 为空时为 {service_id}-stream-{序号}
+	ServerAddr string              `yaml:"server_addr"`
+	ServerPort int                 `yaml:"server_port"`
+	RemoteAddr string              `yaml:"remote_addr"`        // 客户端地址或 CIDR
+	SNI        string              `yaml:"sni"`                // TLS over TCP 时按 SNI 匹配
+	Upstream   *StreamUpstreamSpec `yaml:"upstream,omitempty"` // 为空时使用服务的 upstream
+	Plugins    []PluginSpec        `yaml:"plugins"`
+}
+
+// StreamUpstreamSpec 四层路由的内联 upstream
+type StreamUpstreamSpec struct {
+	Type   string         `yaml:"type"`
+	Nodes  map[string]int `yaml:"nodes"`
+	Scheme string         `yaml:"scheme"` // tcp/udp/tls，默认 tcp
+}
+
+// PluginConfigSpec 具名插件组，注册到 /plugin_configs 后由路由通过 plugin_config_id 引用
+type PluginConfigSpec struct {
+	ID      string       `yaml:"id"`
+	Desc    string       `yaml:"desc"`
+	Plugins []PluginSpec `yaml:"plugins"`
+}
+
+// AdminTLSSpec 访问 Admin API 的 TLS/mTLS 配置，证书文件轮换后自动重新加载
+type AdminTLSSpec struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // 仅用于调试，会打印告警
+}
+
+// SecretSourceSpec 密钥来源：env/file/vault，按 refresh_interval 周期性重新读取以支持轮换
+type SecretSourceSpec struct {
+	Type            string           `yaml:"type"`
+	Env             string           `yaml:"env"`
+	File            string           `yaml:"file"`
+	Vault           *VaultSecretSpec `yaml:"vault,omitempty"`
+	RefreshInterval time.Duration    `yaml:"refresh_interval"` // 默认 1m
+}
+
+// VaultSecretSpec Vault KV 读取配置，token 优先读取 token_file，其次 token、VAULT_TOKEN
+type VaultSecretSpec struct {
+	Address   string `yaml:"address"`
+	Path      string `yaml:"path"` // 例如 secret/data/apisix（KV v2）
+	Field     string `yaml:"field"`
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+	Namespace string `yaml:"namespace"`
+}
+
+// SSLSpec APISIX SSL 对象，证书文件变化后自动重新注册
+type SSLSpec struct {
+	ID           string   `yaml:"id"` // 为空时为 {service_id}-ssl-{序号}
+	CertFile     string   `yaml:"cert_file"`
+	KeyFile      string   `yaml:"key_file"`
+	SNIs         []string `yaml:"snis"`           // 为空时使用证书中的 DNS 名称
+	ClientCAFile string   `yaml:"client_ca_file"` // 设置后校验客户端证书（mTLS）
+	ClientDepth  int      `yaml:"client_depth"`
+}
+
+// StandaloneSpec APISIX standalone 模式配置
+type StandaloneSpec struct {
+	Path string `yaml:"path"` // apisix.yaml 路径，如 /usr/local/apisix/conf/apisix.yaml
+}
+
+// EtcdSpec 直接写入 APISIX 使用的 etcd（v3 JSON gateway）
+type EtcdSpec struct {
+	Endpoints []string      `yaml:"endpoints"` // 如 http://etcd:2379
+	Prefix    string        `yaml:"prefix"`    // 与 APISIX deployment.etcd.prefix 一致，默认 /apisix
+	Username  string        `yaml:"username"`
+	Password  string        `yaml:"password"`
+	TLS       *AdminTLSSpec `yaml:"tls,omitempty"`
+}
+
 type Config struct {
 	// APISIX 管理 API 地址和密钥
 	// 支持通过环境变量 APISIX_ADMIN_API 和 APISIX_ADMIN_KEY 设置
 	// 如果未设置，则使用默认值 http://
-	Debug          bool             `yaml:"debug"`
-	AdminAPI       string           `yaml:"admin_api"`
-	AdminKey       string           `yaml:"admin_key"`
-	ServiceVersion string           `yaml:"service_version"`
-	ServiceName    string           `yaml:"service_name"`
-	ServiceID      string           `yaml:"service_id"`
-	ServicePort    int              `yaml:"service_port"`
-	ProtoPath      string           `yaml:"proto_path"`
-	ProtoPbPath    string           `yaml:"proto_pb_path"`
-	RoutePlugins   []PluginSpec     `yaml:"route_plugins"`
-	Upstream       *UpstreamSpec    `yaml:"upstream,omitempty"`
-	TTL            int              `yaml:"ttl"`
-	MaxRetry       int              `yaml:"max_retry"`
-	RetryInterval  time.Duration    `yaml:"retry_interval"`
-	Consumers      []ConsumerConfig `yaml:"consumers"`
-	Routes         []RouteConfig    `yaml:"routes"`
+	Debug             bool                 `yaml:"debug"`
+	AdminAPI          string               `yaml:"admin_api"`
+	AdminKey          string               `yaml:"admin_key"`
+	AdminKeyFile      string               `yaml:"admin_key_file"` // 从文件读取 admin key，定期重新读取以支持轮换
+	AdminKeySource    *SecretSourceSpec    `yaml:"admin_key_source,omitempty"`
+	AdminTLS          *AdminTLSSpec        `yaml:"admin_tls,omitempty"`
+	Backend           string               `yaml:"backend"` // admin_api（默认）/standalone/etcd
+	Standalone        *StandaloneSpec      `yaml:"standalone,omitempty"`
+	Etcd              *EtcdSpec            `yaml:"etcd,omitempty"`
+	ApisixVersion     string               `yaml:"apisix_version"` // 网关版本，如 "3.8"；为空或 auto 时启动时自动探测
+	ServiceVersion    string               `yaml:"service_version"`
+	ServiceName       string               `yaml:"service_name"`
+	ServiceID         string               `yaml:"service_id"`
+	ServicePort       int                  `yaml:"service_port"`
+	Service           *ServiceSpec         `yaml:"service,omitempty"`
+	ProtoPath         string               `yaml:"proto_path"`
+	ProtoPbPath       string               `yaml:"proto_pb_path"`
+	RoutePlugins      []PluginSpec         `yaml:"route_plugins"`
+	RoutePluginConfig string               `yaml:"route_plugin_config"` // proto 路由引用的 plugin_configs ID
+	RouteDefaults     *RouteMatchSpec      `yaml:"route_defaults,omitempty"`
+	PluginConfigs     []PluginConfigSpec   `yaml:"plugin_configs"`
+	GlobalRules       []GlobalRuleSpec     `yaml:"global_rules"`
+	PluginMetadata    []PluginMetadataSpec `yaml:"plugin_metadata"`
+	StreamRoutes      []StreamRouteSpec    `yaml:"stream_routes"`
+	ValidateSchema    bool                 `yaml:"validate_schema"` // 写入前通过 Admin API /schema 接口本地校验 payload
+	Upstream          *UpstreamSpec        `yaml:"upstream,omitempty"`
+	TTL               int                  `yaml:"ttl"`
+	MaxRetry          int                  `yaml:"max_retry"`
+	RetryInterval     time.Duration        `yaml:"retry_interval"`     // 首次重试退避时间，之后指数增长，最小 3s
+	RetryMaxInterval  time.Duration        `yaml:"retry_max_interval"` // 单次退避上限，默认 30s
+	RetryMaxElapsed   time.Duration        `yaml:"retry_max_elapsed"`  // 单个请求的重试总耗时预算，默认 2m，负数不限制
+	RequestTimeout    time.Duration        `yaml:"request_timeout"`    // 单次 Admin API 请求超时，默认 10s
+	Concurrency       int                  `yaml:"concurrency"`        // 批量写入路由的并发数，默认 4
+	QPS               float64              `yaml:"qps"`                // Admin API 请求速率上限（含重试），0 不限制
+	BreakerThreshold  int                  `yaml:"breaker_threshold"`  // 连续失败多少次后熔断，默认 5，负数关闭熔断
+	BreakerCooldown   time.Duration        `yaml:"breaker_cooldown"`   // 熔断后多久进入半开探测，默认 30s
+	Consumers         []ConsumerConfig     `yaml:"consumers"`
+	SSLs              []SSLSpec            `yaml:"ssls"`
+	SSLCheckInterval  time.Duration        `yaml:"ssl_check_interval"` // 检查证书文件变化与过期的间隔，默认 1m
+	SSLExpiryWarning  time.Duration        `yaml:"ssl_expiry_warning"` // 证书剩余有效期低于该值时告警，默认 720h
+	Routes            []RouteConfig        `yaml:"routes"`
+	Canary            *CanarySpec          `yaml:"canary,omitempty"`
+}
+
+// dollarPlaceholder expandEnv 中临时替换 $$ 的占位符
+const dollarPlaceholder = "\x00DOLLAR\x00"
+
+// expandEnv 与 os.ExpandEnv 相同，但 $$ 输出字面量 $
+func expandEnv(s string) string {
+	s = strings.ReplaceAll(s, "$$", dollarPlaceholder)
+	return strings.ReplaceAll(os.ExpandEnv(s), dollarPlaceholder, "$")
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -71,8 +303,8 @@ func LoadConfig(path string) (*Config, error) {
 	if file, err := os.Open(path); err == nil {
 		defer file.Close()
 		if data, err := io.ReadAll(file); err == nil {
-			// 支持 ENV 占位符自动替换
-			content := os.ExpandEnv(string(data))
+			// 支持 ENV 占位符自动替换，$$ 转义为字面量 $（如 nginx 变量 $$host）
+			content := expandEnv(string(data))
 			yaml.Unmarshal([]byte(content), cfg)
 		}
 	}
@@ -89,9 +321,73 @@ func LoadConfig(path string) (*Config, error) {
 	if v := os.Getenv("APISIX_ADMIN_KEY"); v != "" {
 		cfg.AdminKey = v
 	}
+	if v := os.Getenv("APISIX_ADMIN_KEY_FILE"); v != "" {
+		cfg.AdminKeyFile = v
+	}
+	if v := os.Getenv("REGISTRY_BACKEND"); v != "" {
+		cfg.Backend = v
+	}
+	if v := os.Getenv("APISIX_STANDALONE_PATH"); v != "" {
+		if cfg.Standalone == nil {
+			cfg.Standalone = &StandaloneSpec{}
+		}
+		cfg.Standalone.Path = v
+	}
+	etcd := func() *EtcdSpec {
+		if cfg.Etcd == nil {
+			cfg.Etcd = &EtcdSpec{}
+		}
+		return cfg.Etcd
+	}
+	if v := os.Getenv("ETCD_ENDPOINTS"); v != "" {
+		etcd().Endpoints = strings.Split(v, ",")
+	}
+	if v := os.Getenv("ETCD_PREFIX"); v != "" {
+		etcd().Prefix = v
+	}
+	if v := os.Getenv("ETCD_USERNAME"); v != "" {
+		etcd().Username = v
+	}
+	if v := os.Getenv("ETCD_PASSWORD"); v != "" {
+		etcd().Password = v
+	}
+	if v := os.Getenv("REGISTRY_VALIDATE_SCHEMA"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.ValidateSchema = b
+		}
+	}
+	if v := os.Getenv("APISIX_VERSION"); v != "" {
+		cfg.ApisixVersion = v
+	}
+	adminTLS := func() *AdminTLSSpec {
+		if cfg.AdminTLS == nil {
+			cfg.AdminTLS = &AdminTLSSpec{}
+		}
+		return cfg.AdminTLS
+	}
+	if v := os.Getenv("APISIX_ADMIN_TLS_CA"); v != "" {
+		adminTLS().CAFile = v
+	}
+	if v := os.Getenv("APISIX_ADMIN_TLS_CERT"); v != "" {
+		adminTLS().CertFile = v
+	}
+	if v := os.Getenv("APISIX_ADMIN_TLS_KEY"); v != "" {
+		adminTLS().KeyFile = v
+	}
+	if v := os.Getenv("APISIX_ADMIN_TLS_SERVER_NAME"); v != "" {
+		adminTLS().ServerName = v
+	}
+	if v := os.Getenv("APISIX_ADMIN_TLS_INSECURE_SKIP_VERIFY"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			adminTLS().InsecureSkipVerify = b
+		}
+	}
 	if v := os.Getenv("SERVICE_NAME"); v != "" {
 		cfg.ServiceName = v
 	}
+	if v := os.Getenv("SERVICE_VERSION"); v != "" {
+		cfg.ServiceVersion = v
+	}
 	if v := os.Getenv("SERVICE_ID"); v != "" {
 		cfg.ServiceID = v
 	}
@@ -104,6 +400,10 @@ func LoadConfig(path string) (*Config, error) {
 	if v := os.Getenv("PROTO_PB_PATH"); v != "" {
 		cfg.ProtoPbPath = v
 	}
+	// 只覆盖已有的 upstream 配置；未配置 upstream 时由 RunContext 直接读取，避免改变反注册行为
+	if v := os.Getenv("REGISTRY_UPSTREAM_SCHEME"); v != "" && cfg.Upstream != nil {
+		cfg.Upstream.Scheme = v
+	}
 	if v := os.Getenv("REGISTRY_TTL"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			cfg.TTL = n
@@ -119,6 +419,41 @@ func LoadConfig(path string) (*Config, error) {
 			cfg.RetryInterval = duration
 		}
 	}
+	if v := os.Getenv("REGISTRY_RETRY_MAX_INTERVAL"); v != "" {
+		if duration, err := time.ParseDuration(v); err == nil {
+			cfg.RetryMaxInterval = duration
+		}
+	}
+	if v := os.Getenv("REGISTRY_RETRY_MAX_ELAPSED"); v != "" {
+		if duration, err := time.ParseDuration(v); err == nil {
+			cfg.RetryMaxElapsed = duration
+		}
+	}
+	if v := os.Getenv("REGISTRY_REQUEST_TIMEOUT"); v != "" {
+		if duration, err := time.ParseDuration(v); err == nil {
+			cfg.RequestTimeout = duration
+		}
+	}
+	if v := os.Getenv("REGISTRY_CONCURRENCY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Concurrency = n
+		}
+	}
+	if v := os.Getenv("REGISTRY_QPS"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.QPS = f
+		}
+	}
+	if v := os.Getenv("REGISTRY_BREAKER_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.BreakerThreshold = n
+		}
+	}
+	if v := os.Getenv("REGISTRY_BREAKER_COOLDOWN"); v != "" {
+		if duration, err := time.ParseDuration(v); err == nil {
+			cfg.BreakerCooldown = duration
+		}
+	}
 	if cfg.TTL < 60 {
 		cfg.TTL = 60 // 默认值
 	}
@@ -128,5 +463,38 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.RetryInterval < 3*time.Second {
 		cfg.RetryInterval = 3 * time.Second
 	}
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
+
+// validateConfig 检查配置项之间的引用关系，错误配置在启动前失败，而不是写入后被 APISIX 拒绝
+func validateConfig(cfg *Config) error {
+	// 节点来源同步的是 nodes，与 APISIX 服务发现（discovery_type）互斥
+	if cfg.Upstream != nil && cfg.Upstream.Source != nil && os.Getenv("REGISTRY_USE_DISCOVERY") == "true" {
+		return fmt.Errorf("upstream.source cannot be used with REGISTRY_USE_DISCOVERY=true: the source writes upstream nodes, discovery makes APISIX resolve them itself")
+	}
+	if len(cfg.PluginConfigs) > 0 && cfg.ServiceID == "" && cfg.ServiceName == "" {
+		return fmt.Errorf("plugin_configs: service_id is required")
+	}
+	pluginConfigs := map[string]bool{}
+	for i, spec := range cfg.PluginConfigs {
+		if spec.ID == "" || strings.Contains(spec.ID, ".") {
+			return fmt.Errorf("plugin_configs[%d]: id %q must be non-empty and must not contain '.'", i, spec.ID)
+		}
+		if pluginConfigs[spec.ID] {
+			return fmt.Errorf("plugin_configs[%d]: duplicate id %q", i, spec.ID)
+		}
+		pluginConfigs[spec.ID] = true
+	}
+	if id := cfg.RoutePluginConfig; id != "" && !pluginConfigs[id] {
+		return fmt.Errorf("route_plugin_config: %q is not defined in plugin_configs", id)
+	}
+	for i, r := range cfg.Routes {
+		if r.PluginConfig != "" && !pluginConfigs[r.PluginConfig] {
+			return fmt.Errorf("routes[%d].plugin_config: %q is not defined in plugin_configs", i, r.PluginConfig)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_UpstreamSchemeEnv(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("REGISTRY_UPSTREAM_SCHEME", "grpcs")
+
+	// 未配置 upstream 时不应创建 upstream 配置（否则退出时会删除 upstream）
+	cfg, err := LoadConfig(filepath.Join(dir, "missing.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Upstream != nil {
+		t.Errorf("expected no upstream spec, got %+v", cfg.Upstream)
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	os.WriteFile(path, []byte("upstream:\n  scheme: grpc\n"), 0o644)
+	cfg, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Upstream == nil || cfg.Upstream.Scheme != "grpcs" {
+		t.Errorf("expected env to override upstream.scheme, got %+v", cfg.Upstream)
+	}
+}
+
+func TestExpandEnv_EscapedDollar(t *testing.T) {
+	t.Setenv("REGISTRY_TEST_HOST", "auth")
+	got := expandEnv(`node: "${REGISTRY_TEST_HOST}:8082"` + "\n" + `host: "$$host"`)
+	want := `node: "auth:8082"` + "\n" + `host: "$host"`
+	if got != want {
+		t.Errorf("unexpected expansion:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestValidateConfig_PluginConfigs(t *testing.T) {
+	common := PluginConfigSpec{ID: "common", Plugins: []PluginSpec{{Name: "cors"}}}
+	cases := []struct {
+		name string
+		cfg  Config
+		err  string
+	}{
+		{"ok", Config{ServiceID: "auth", PluginConfigs: []PluginConfigSpec{common}, RoutePluginConfig: "common",
+			Routes: []RouteConfig{{URI: "/v1/login", PluginConfig: "common"}}}, ""},
+		{"no owner", Config{PluginConfigs: []PluginConfigSpec{common}}, "service_id is required"},
+		{"empty id", Config{ServiceID: "auth", PluginConfigs: []PluginConfigSpec{{}}}, "must be non-empty"},
+		{"dotted id", Config{ServiceID: "auth", PluginConfigs: []PluginConfigSpec{{ID: "a.b"}}}, "must not contain"},
+		{"duplicate", Config{ServiceID: "auth", PluginConfigs: []PluginConfigSpec{common, common}}, "duplicate id"},
+		{"unknown route_plugin_config", Config{ServiceID: "auth", RoutePluginConfig: "missing"}, "route_plugin_config"},
+		{"unknown route reference", Config{ServiceID: "auth", PluginConfigs: []PluginConfigSpec{common},
+			Routes: []RouteConfig{{URI: "/v1/login", PluginConfig: "missing"}}}, "routes[0].plugin_config"},
+	}
+	for _, c := range cases {
+		err := validateConfig(&c.cfg)
+		if c.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: expected error containing %q, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestValidateConfig_SourceWithDiscovery(t *testing.T) {
+	cfg := &Config{ServiceID: "auth", Upstream: &UpstreamSpec{Source: &NodeSourceSpec{Type: "file", File: &FileSourceSpec{Path: "targets.json"}}}}
+	if err := validateConfig(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Setenv("REGISTRY_USE_DISCOVERY", "true")
+	if err := validateConfig(cfg); err == nil || !strings.Contains(err.Error(), "REGISTRY_USE_DISCOVERY") {
+		t.Errorf("expected source with discovery to be rejected, got %v", err)
+	}
+	if err := RunContext(context.Background(), cfg); err == nil {
+		t.Error("expected RunContext to fail")
+	}
+}
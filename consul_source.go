@@ -0,0 +1,149 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConsulSource 查询 Consul 中 passing 状态的服务实例，通过 blocking query 监听变化
+type ConsulSource struct {
+	Address       string
+	Service       string
+	Datacenter    string
+	Tag           string
+	Token         string
+	WaitTime      time.Duration
+	HTTPClient    *http.Client
+	RetryInterval time.Duration
+}
+
+type consulServiceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+		Weights struct {
+			Passing int `json:"Passing"`
+		} `json:"Weights"`
+	} `json:"Service"`
+}
+
+func NewConsulSource(spec *ConsulSourceSpec) (*ConsulSource, error) {
+	if spec.Address == "" || spec.Service == "" {
+		return nil, fmt.Errorf("node source consul: address and service are required")
+	}
+	s := &ConsulSource{
+		Address:       strings.TrimRight(spec.Address, "/"),
+		Service:       spec.Service,
+		Datacenter:    spec.Datacenter,
+		Tag:           spec.Tag,
+		Token:         spec.Token,
+		WaitTime:      spec.WaitTime,
+		HTTPClient:    &http.Client{},
+		RetryInterval: 5 * time.Second,
+	}
+	if s.WaitTime <= 0 {
+		s.WaitTime = 5 * time.Minute
+	}
+	return s, nil
+}
+
+// query 查询健康实例，index 非空时为 blocking query，返回新的 X-Consul-Index
+func (s *ConsulSource) query(ctx context.Context, index string) (map[string]int, string, error) {
+	q := url.Values{}
+	q.Set("passing", "true")
+	if s.Datacenter != "" {
+		q.Set("dc", s.Datacenter)
+	}
+	if s.Tag != "" {
+		q.Set("tag", s.Tag)
+	}
+	if index != "" {
+		q.Set("index", index)
+		q.Set("wait", s.WaitTime.String())
+	}
+	u := fmt.Sprintf("%s/v1/health/service/%s?%s", s.Address, url.PathEscape(s.Service), q.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.Token != "" {
+		req.Header.Set("X-Consul-Token", s.Token)
+	}
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("consul %s: status=%d", u, resp.StatusCode)
+	}
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, "", fmt.Errorf("decode consul response: %w", err)
+	}
+	nodes := map[string]int{}
+	for _, e := range entries {
+		addr := e.Service.Address
+		if addr == "" {
+			addr = e.Node.Address
+		}
+		weight := e.Service.Weights.Passing
+		if weight <= 0 {
+			weight = 1
+		}
+		nodes[net.JoinHostPort(addr, strconv.Itoa(e.Service.Port))] = weight
+	}
+	return nodes, resp.Header.Get("X-Consul-Index"), nil
+}
+
+func (s *ConsulSource) Nodes(ctx context.Context) (map[string]int, error) {
+	nodes, _, err := s.query(ctx, "")
+	return nodes, err
+}
+
+func (s *ConsulSource) Watch(ctx context.Context, update func(nodes map[string]int)) error {
+	index := ""
+	for {
+		nodes, newIndex, err := s.query(ctx, index)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("[APISIX-AGENT][Warn] Consul watch %s: %v", s.Service, err)
+			index = ""
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.RetryInterval):
+			}
+			continue
+		}
+		n, _ := strconv.ParseUint(newIndex, 10, 64)
+		o, _ := strconv.ParseUint(index, 10, 64)
+		if index == "" || n != o {
+			update(nodes)
+		}
+		// index 为 0 或回退时按 Consul 约定重置，并避免空转
+		if n == 0 || n < o {
+			index = ""
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.RetryInterval):
+			}
+			continue
+		}
+		index = newIndex
+	}
+}
@@ -0,0 +1,57 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConsulSource_BlockingQuery(t *testing.T) {
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/auth" || r.URL.Query().Get("passing") != "true" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			t.Errorf("missing consul token")
+		}
+		switch r.URL.Query().Get("index") {
+		case "":
+			w.Header().Set("X-Consul-Index", "5")
+			fmt.Fprint(w, `[{"Node":{"Address":"10.0.0.1"},"Service":{"Address":"","Port":8082,"Weights":{"Passing":1}}}]`)
+		default:
+			if r.URL.Query().Get("wait") == "" {
+				t.Errorf("blocking query without wait: %s", r.URL)
+			}
+			w.Header().Set("X-Consul-Index", "6")
+			fmt.Fprint(w, `[{"Node":{"Address":"10.0.0.1"},"Service":{"Address":"","Port":8082,"Weights":{"Passing":1}}},
+				{"Node":{"Address":"node-2"},"Service":{"Address":"10.0.0.2","Port":8082,"Weights":{"Passing":3}}}]`)
+		}
+	}))
+	defer consul.Close()
+
+	src, err := NewConsulSource(&ConsulSourceSpec{Address: consul.URL, Service: "auth", Token: "secret"})
+	if err != nil {
+		t.Fatalf("NewConsulSource error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var updates []map[string]int
+	src.Watch(ctx, func(nodes map[string]int) {
+		updates = append(updates, nodes)
+		if len(updates) == 2 {
+			cancel()
+		}
+	})
+	if len(updates) != 2 {
+		t.Fatalf("expected 2 updates, got %d", len(updates))
+	}
+	if updates[0]["10.0.0.1:8082"] != 1 || len(updates[0]) != 1 {
+		t.Errorf("unexpected initial nodes: %v", updates[0])
+	}
+	if updates[1]["10.0.0.2:8082"] != 3 || len(updates[1]) != 2 {
+		t.Errorf("unexpected nodes after change: %v", updates[1])
+	}
+}
@@ -0,0 +1,544 @@
+package apisixregistryagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 不随 agent 租约过期的资源：consumer 与插件元数据由多个服务共享，注销时也不会删除；
+// service 由各版本共享并在 promote/rollback 时原地修改，不能随某一个实例的租约过期
+var etcdUnleasedResources = map[string]bool{
+	"consumers":       true,
+	"plugin_metadata": true,
+	"services":        true,
+}
+
+// etcdPatchRetries PATCH 读-改-写遇到并发修改时的重试次数
+const etcdPatchRetries = 3
+
+// EtcdBackend 直接读写 APISIX 使用的 etcd（v3 JSON gateway，/v3/kv/*），key 为 {prefix}/routes/{id} 等。
+// agent 写入的资源绑定到 TTL 秒的租约并定期续约，agent 异常退出后资源随租约过期自动清理
+type EtcdBackend struct {
+	Endpoints []string
+	Prefix    string
+	Username  string
+	Password  string
+	TTL       int // 租约秒数
+
+	HTTPClient *http.Client
+
+	mu       sync.Mutex
+	endpoint int // 最近一次可用的 endpoint
+	token    string
+	lease    int64
+	owned    map[string][]byte // 绑定租约的 key 及最近写入的值，租约丢失后重新写入
+}
+
+func NewEtcdBackend(spec *EtcdSpec, ttl int) (*EtcdBackend, error) {
+	if spec == nil || len(spec.Endpoints) == 0 {
+		return nil, fmt.Errorf("etcd backend: endpoints are required")
+	}
+	prefix := strings.TrimSuffix(spec.Prefix, "/")
+	if prefix == "" {
+		prefix = "/apisix"
+	}
+	if ttl <= 0 {
+		ttl = 60
+	}
+	hc := &http.Client{Timeout: 10 * time.Second}
+	if spec.TLS != nil {
+		tlsCfg, err := NewAdminTLSConfig(spec.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("etcd backend: %w", err)
+		}
+		hc.Transport = &http.Transport{TLSClientConfig: tlsCfg}
+	}
+	endpoints := make([]string, 0, len(spec.Endpoints))
+	for _, e := range spec.Endpoints {
+		endpoints = append(endpoints, strings.TrimSuffix(e, "/"))
+	}
+	return &EtcdBackend{
+		Endpoints:  endpoints,
+		Prefix:     prefix,
+		Username:   spec.Username,
+		Password:   spec.Password,
+		TTL:        ttl,
+		HTTPClient: hc,
+		owned:      map[string][]byte{},
+	}, nil
+}
+
+// etcdInt JSON gateway 将 int64 编码为字符串
+type etcdInt int64
+
+func (n *etcdInt) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	*n = etcdInt(v)
+	return err
+}
+
+type etcdKV struct {
+	Key         string  `json:"key"`
+	Value       string  `json:"value"`
+	ModRevision etcdInt `json:"mod_revision"`
+	Lease       etcdInt `json:"lease"`
+}
+
+type etcdRangeResponse struct {
+	Kvs   []etcdKV `json:"kvs"`
+	Count etcdInt  `json:"count"`
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// prefixEnd 返回前缀查询的 range_end
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return "\x00"
+}
+
+func (b *EtcdBackend) Request(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	resource, id, ok := parseResourcePath(path)
+	if !ok {
+		return nil, unsupportedPath("etcd", method, path)
+	}
+	key := b.Prefix + resourceKey(resource, id)
+
+	switch method {
+	case "GET":
+		if id == "" {
+			kvs, err := b.rangePrefix(ctx, b.Prefix+"/"+resource+"/")
+			if err != nil {
+				return nil, err
+			}
+			values := make([]map[string]interface{}, 0, len(kvs))
+			for _, kv := range kvs {
+				var v map[string]interface{}
+				if err := json.Unmarshal(kv.value, &v); err != nil {
+					log.Printf("[APISIX-AGENT][Warn] Skip invalid etcd value %s: %v", kv.key, err)
+					continue
+				}
+				values = append(values, v)
+			}
+			return listResponse(path, b.Prefix, resource, values)
+		}
+		value, _, _, err := b.get(ctx, method, path, key)
+		if err != nil {
+			return nil, err
+		}
+		return itemResponse(b.Prefix, resource, id, json.RawMessage(value))
+	case "DELETE":
+		var resp struct {
+			Deleted etcdInt `json:"deleted"`
+		}
+		if err := b.call(ctx, "/v3/kv/deleterange", map[string]interface{}{"key": b64(key)}, &resp); err != nil {
+			return nil, err
+		}
+		b.mu.Lock()
+		delete(b.owned, key)
+		b.mu.Unlock()
+		// key 已随租约过期或已删除：返回 404，由 doRequest 按删除成功处理
+		if resp.Deleted == 0 {
+			return nil, backendError(method, path, http.StatusNotFound, "Key not found")
+		}
+		return []byte(`{}`), nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		var current map[string]interface{}
+		var rev, lease etcdInt
+		if method == "PATCH" {
+			// PATCH 保留 key 原有的租约：promote/rollback 等命令不续约，不能把资源绑定到自己的租约上
+			data, modRev, keyLease, err := b.get(ctx, method, path, key)
+			if err != nil && !IsNotFound(err) {
+				return nil, err
+			}
+			if err == nil {
+				if err := json.Unmarshal(data, &current); err != nil {
+					return nil, fmt.Errorf("etcd %s: invalid value: %w", key, err)
+				}
+			}
+			rev, lease = modRev, keyLease
+		} else if !etcdUnleasedResources[resource] {
+			id, err := b.leaseID(ctx)
+			if err != nil {
+				return nil, err
+			}
+			lease = etcdInt(id)
+		}
+		value, err := applyWrite(method, path, resource, id, current, body)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		// PATCH 仅在读取后未被修改时写入，避免覆盖并发写入
+		written, err := b.put(ctx, key, data, int64(lease), method == "PATCH", rev)
+		if err != nil {
+			return nil, err
+		}
+		if written {
+			return itemResponse(b.Prefix, resource, id, value)
+		}
+		if attempt+1 >= etcdPatchRetries {
+			return nil, backendError(method, path, http.StatusConflict, "concurrent modification of %s", key)
+		}
+	}
+}
+
+type etcdValue struct {
+	key   string
+	value []byte
+}
+
+// rangePrefix 读取以 prefix 开头的全部 key
+func (b *EtcdBackend) rangePrefix(ctx context.Context, prefix string) ([]etcdValue, error) {
+	req := map[string]interface{}{"key": b64(prefix), "range_end": b64(prefixEnd(prefix))}
+	var resp etcdRangeResponse
+	if err := b.call(ctx, "/v3/kv/range", req, &resp); err != nil {
+		return nil, err
+	}
+	out := make([]etcdValue, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		k, _ := base64.StdEncoding.DecodeString(kv.Key)
+		v, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("etcd %s: invalid value: %w", k, err)
+		}
+		out = append(out, etcdValue{key: string(k), value: v})
+	}
+	return out, nil
+}
+
+// get 读取单个 key，返回值、mod_revision 与绑定的租约（0 表示未绑定）
+func (b *EtcdBackend) get(ctx context.Context, method, path, key string) ([]byte, etcdInt, etcdInt, error) {
+	var resp etcdRangeResponse
+	if err := b.call(ctx, "/v3/kv/range", map[string]interface{}{"key": b64(key)}, &resp); err != nil {
+		return nil, 0, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, 0, backendError(method, path, http.StatusNotFound, "Key not found")
+	}
+	v, err := base64.StdEncoding.DecodeString(resp.Kvs[0].Value)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("etcd %s: invalid value: %w", key, err)
+	}
+	return v, resp.Kvs[0].ModRevision, resp.Kvs[0].Lease, nil
+}
+
+// put 以 lease（0 表示不绑定）写入 key；checkRev 为 true 时通过事务比较 mod_revision（0 表示 key 不存在），
+// 不一致返回 false。只有绑定本 agent 当前租约的 key 记入 owned
+func (b *EtcdBackend) put(ctx context.Context, key string, value []byte, lease int64, checkRev bool, rev etcdInt) (bool, error) {
+	req := map[string]interface{}{"key": b64(key), "value": base64.StdEncoding.EncodeToString(value)}
+	if lease != 0 {
+		req["lease"] = strconv.FormatInt(lease, 10)
+	}
+	if !checkRev {
+		if err := b.call(ctx, "/v3/kv/put", req, nil); err != nil {
+			return false, err
+		}
+	} else {
+		txn := map[string]interface{}{
+			"compare": []map[string]interface{}{{
+				"key": b64(key), "target": "MOD", "result": "EQUAL", "mod_revision": strconv.FormatInt(int64(rev), 10),
+			}},
+			"success": []map[string]interface{}{{"request_put": req}},
+		}
+		var resp struct {
+			Succeeded bool `json:"succeeded"`
+		}
+		if err := b.call(ctx, "/v3/kv/txn", txn, &resp); err != nil {
+			return false, err
+		}
+		if !resp.Succeeded {
+			return false, nil
+		}
+	}
+	b.mu.Lock()
+	if lease != 0 && lease == b.lease {
+		b.owned[key] = value
+	} else {
+		delete(b.owned, key)
+	}
+	b.mu.Unlock()
+	return true, nil
+}
+
+// leaseID 返回当前租约，首次写入时创建
+func (b *EtcdBackend) leaseID(ctx context.Context) (int64, error) {
+	b.mu.Lock()
+	lease := b.lease
+	b.mu.Unlock()
+	if lease != 0 {
+		return lease, nil
+	}
+	return b.grantLease(ctx)
+}
+
+func (b *EtcdBackend) grantLease(ctx context.Context) (int64, error) {
+	var resp struct {
+		ID  etcdInt `json:"ID"`
+		TTL etcdInt `json:"TTL"`
+	}
+	if err := b.call(ctx, "/v3/lease/grant", map[string]interface{}{"TTL": b.TTL}, &resp); err != nil {
+		return 0, fmt.Errorf("etcd lease grant: %w", err)
+	}
+	if resp.ID == 0 {
+		return 0, fmt.Errorf("etcd lease grant: empty lease id")
+	}
+	b.mu.Lock()
+	b.lease = int64(resp.ID)
+	b.mu.Unlock()
+	log.Printf("[APISIX-AGENT] etcd lease granted: %d (ttl %ds)", resp.ID, resp.TTL)
+	return int64(resp.ID), nil
+}
+
+// KeepAlive 每 TTL/3 续约一次，直到 ctx 取消。租约已过期时重新创建并写回本 agent 的全部资源；
+// 同 key 被其他副本的租约覆盖后过期删除时，也会在下一次续约时写回
+func (b *EtcdBackend) KeepAlive(ctx context.Context) {
+	interval := time.Duration(b.TTL) * time.Second / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.keepAliveOnce(ctx); err != nil {
+				log.Printf("[APISIX-AGENT][Warn] etcd lease keepalive failed: %v", err)
+			}
+		}
+	}
+}
+
+func (b *EtcdBackend) keepAliveOnce(ctx context.Context) error {
+	b.mu.Lock()
+	lease := b.lease
+	b.mu.Unlock()
+	if lease == 0 {
+		return nil
+	}
+	var resp struct {
+		Result struct {
+			TTL etcdInt `json:"TTL"`
+		} `json:"result"`
+	}
+	if err := b.call(ctx, "/v3/lease/keepalive", map[string]interface{}{"ID": strconv.FormatInt(lease, 10)}, &resp); err != nil {
+		return err
+	}
+	if resp.Result.TTL <= 0 {
+		log.Printf("[APISIX-AGENT][Warn] etcd lease %d expired, re-registering resources", lease)
+		b.mu.Lock()
+		b.lease = 0
+		b.mu.Unlock()
+		if _, err := b.grantLease(ctx); err != nil {
+			return err
+		}
+	}
+	return b.restoreOwned(ctx, resp.Result.TTL <= 0)
+}
+
+// restoreOwned 写回本 agent 的资源；all 为 false 时只写回已不存在的 key
+func (b *EtcdBackend) restoreOwned(ctx context.Context, all bool) error {
+	b.mu.Lock()
+	owned := make(map[string][]byte, len(b.owned))
+	for k, v := range b.owned {
+		owned[k] = v
+	}
+	lease := b.lease
+	b.mu.Unlock()
+	for key, value := range owned {
+		if !all {
+			var resp etcdRangeResponse
+			if err := b.call(ctx, "/v3/kv/range", map[string]interface{}{"key": b64(key), "count_only": true}, &resp); err != nil {
+				return err
+			}
+			if resp.Count > 0 {
+				continue
+			}
+			log.Printf("[APISIX-AGENT][Warn] etcd key %s disappeared, re-registering", key)
+		}
+		if _, err := b.put(ctx, key, value, lease, false, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Detach 将仍绑定本 agent 租约的 key 改为不绑定租约，用于退出时保留交给其他版本继续使用的共享资源。
+// 只在 key 仍属于本租约时改写，其他实例已覆盖的 key 不受影响
+func (b *EtcdBackend) Detach(ctx context.Context) error {
+	b.mu.Lock()
+	lease := b.lease
+	owned := b.owned
+	b.owned = map[string][]byte{}
+	b.mu.Unlock()
+	if lease == 0 {
+		return nil
+	}
+	var errs []error
+	for key, value := range owned {
+		txn := map[string]interface{}{
+			"compare": []map[string]interface{}{{
+				"key": b64(key), "target": "LEASE", "result": "EQUAL", "lease": strconv.FormatInt(lease, 10),
+			}},
+			"success": []map[string]interface{}{{"request_put": map[string]interface{}{
+				"key": b64(key), "value": base64.StdEncoding.EncodeToString(value),
+			}}},
+		}
+		if err := b.call(ctx, "/v3/kv/txn", txn, nil); err != nil {
+			errs = append(errs, fmt.Errorf("detach %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close 撤销本 agent 的租约，仍绑定该租约的 key 随之删除。注销完成后调用，之后不应再写入
+func (b *EtcdBackend) Close(ctx context.Context) error {
+	b.mu.Lock()
+	lease := b.lease
+	b.lease = 0
+	b.owned = map[string][]byte{}
+	b.mu.Unlock()
+	if lease == 0 {
+		return nil
+	}
+	if err := b.call(ctx, "/v3/lease/revoke", map[string]interface{}{"ID": strconv.FormatInt(lease, 10)}, nil); err != nil {
+		return fmt.Errorf("etcd lease revoke: %w", err)
+	}
+	log.Printf("[APISIX-AGENT] etcd lease revoked: %d", lease)
+	return nil
+}
+
+// authenticate 使用用户名密码获取 token
+func (b *EtcdBackend) authenticate(ctx context.Context) error {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	req := map[string]interface{}{"name": b.Username, "password": b.Password}
+	if err := b.post(ctx, "/v3/auth/authenticate", req, &resp, ""); err != nil {
+		return fmt.Errorf("etcd authenticate: %w", err)
+	}
+	b.mu.Lock()
+	b.token = resp.Token
+	b.mu.Unlock()
+	return nil
+}
+
+// call 调用 etcd JSON gateway；启用认证时 token 失效后重新认证一次
+func (b *EtcdBackend) call(ctx context.Context, api string, req, resp interface{}) error {
+	if b.Username == "" {
+		return b.post(ctx, api, req, resp, "")
+	}
+	b.mu.Lock()
+	token := b.token
+	b.mu.Unlock()
+	if token == "" {
+		if err := b.authenticate(ctx); err != nil {
+			return err
+		}
+	}
+	for retried := false; ; retried = true {
+		b.mu.Lock()
+		token = b.token
+		b.mu.Unlock()
+		err := b.post(ctx, api, req, resp, token)
+		var apiErr *APIError
+		if retried || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+			return err
+		}
+		if err := b.authenticate(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// post 依次尝试各 endpoint，网络错误时切换到下一个
+func (b *EtcdBackend) post(ctx context.Context, api string, req, resp interface{}, token string) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	start := b.endpoint
+	b.mu.Unlock()
+	var lastErr error
+	for i := range b.Endpoints {
+		idx := (start + i) % len(b.Endpoints)
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", b.Endpoints[idx]+api, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			httpReq.Header.Set("Authorization", token)
+		}
+		httpResp, err := b.HTTPClient.Do(httpReq)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				return err
+			}
+			continue
+		}
+		b.mu.Lock()
+		b.endpoint = idx
+		b.mu.Unlock()
+		return decodeEtcdResponse(httpResp, api, resp)
+	}
+	return fmt.Errorf("etcd %s: all endpoints failed: %w", api, lastErr)
+}
+
+func decodeEtcdResponse(httpResp *http.Response, api string, resp interface{}) error {
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode >= 300 {
+		body, _ := io.ReadAll(httpResp.Body)
+		var e struct {
+			Message string `json:"message"`
+			Error   string `json:"error"`
+		}
+		msg := strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &e) == nil && (e.Message != "" || e.Error != "") {
+			msg = e.Message
+			if msg == "" {
+				msg = e.Error
+			}
+		}
+		return &APIError{Method: "POST", Path: api, StatusCode: httpResp.StatusCode, Message: msg, Attempts: 1}
+	}
+	if resp == nil {
+		io.Copy(io.Discard, httpResp.Body)
+		return nil
+	}
+	// lease keepalive 为流式响应，只读取第一条
+	if err := json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+		return fmt.Errorf("etcd %s: decode response: %w", api, err)
+	}
+	return nil
+}
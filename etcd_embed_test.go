@@ -0,0 +1,179 @@
+//go:build etcd_embed
+
+package apisixregistryagent
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// 针对真实 etcd（进程内嵌入）验证 JSON gateway 的租约与事务行为：
+//
+//	go test -tags etcd_embed -run Embedded
+func startEmbeddedEtcd(t *testing.T) string {
+	t.Helper()
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "fatal"
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatal("embedded etcd not ready")
+	}
+	return clientURL.String()
+}
+
+func freeURL(t *testing.T) url.URL {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+// keyLease 返回 key 绑定的租约，key 不存在时 ok 为 false
+func keyLease(t *testing.T, eb *EtcdBackend, key string) (int64, bool) {
+	t.Helper()
+	_, _, lease, err := eb.get(context.Background(), "GET", key, key)
+	if IsNotFound(err) {
+		return 0, false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(lease), true
+}
+
+func waitKeyGone(t *testing.T, eb *EtcdBackend, key string) {
+	t.Helper()
+	for deadline := time.Now().Add(15 * time.Second); time.Now().Before(deadline); time.Sleep(200 * time.Millisecond) {
+		if _, ok := keyLease(t, eb, key); !ok {
+			return
+		}
+	}
+	t.Fatalf("expected %s to expire with its lease", key)
+}
+
+func TestEtcdBackend_Embedded(t *testing.T) {
+	endpoint := startEmbeddedEtcd(t)
+	// etcd 的最小租约约为 2 秒
+	cfg := &Config{Backend: "etcd", TTL: 2, Etcd: &EtcdSpec{Endpoints: []string{endpoint}}}
+	client := NewApisixClient(cfg)
+	eb := client.Backend.(*EtcdBackend)
+	ctx := context.Background()
+	if err := client.EnsureVersion(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RegisterService(ctx, NewService("auth", "auth", "auth")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RegisterRoute(ctx, NewRoute("auth-0", "auth", "/v1/login")); err != nil {
+		t.Fatal(err)
+	}
+	routeKey := "/apisix/routes/auth-0"
+	lease, ok := keyLease(t, eb, routeKey)
+	if !ok || lease == 0 || lease != eb.lease {
+		t.Fatalf("expected route on lease %d, got %d ok=%v", eb.lease, lease, ok)
+	}
+	if lease, _ := keyLease(t, eb, "/apisix/services/auth"); lease != 0 {
+		t.Errorf("expected service without lease, got %d", lease)
+	}
+
+	// 事务比较：mod_revision 0 匹配不存在的 key，key 存在后不再匹配
+	cmpKey := "/apisix/routes/cmp"
+	if written, err := eb.put(ctx, cmpKey, []byte(`{"id":"cmp"}`), 0, true, 0); err != nil || !written {
+		t.Fatalf("expected put on missing key with mod_revision 0, written=%v err=%v", written, err)
+	}
+	if written, err := eb.put(ctx, cmpKey, []byte(`{"id":"cmp"}`), 0, true, 0); err != nil || written {
+		t.Fatalf("expected compare on existing key to fail, written=%v err=%v", written, err)
+	}
+	_, rev, _, err := eb.get(ctx, "GET", cmpKey, cmpKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written, err := eb.put(ctx, cmpKey, []byte(`{"id":"cmp","desc":"x"}`), 0, true, rev); err != nil || !written {
+		t.Fatalf("expected compare on current mod_revision to succeed, written=%v err=%v", written, err)
+	}
+
+	// PATCH 保留原有租约，调用方不创建租约
+	other := NewApisixClient(cfg)
+	if _, err := other.doRequest(ctx, "PATCH", "/routes/auth-0", map[string]interface{}{"desc": "patched"}); err != nil {
+		t.Fatal(err)
+	}
+	if patched, _ := keyLease(t, eb, routeKey); patched != lease {
+		t.Errorf("expected patch to keep lease %d, got %d", lease, patched)
+	}
+	if otherEB := other.Backend.(*EtcdBackend); otherEB.lease != 0 {
+		t.Errorf("expected patch not to grant a lease, got %d", otherEB.lease)
+	}
+	if _, err := other.doRequest(ctx, "PATCH", "/routes/missing", map[string]interface{}{"desc": "x"}); !IsNotFound(err) {
+		t.Errorf("expected not found patching a missing key, got %v", err)
+	}
+
+	// 不续约时租约过期，绑定的 key 被删除，未绑定租约的 service 保留
+	waitKeyGone(t, eb, routeKey)
+	if _, ok := keyLease(t, eb, "/apisix/services/auth"); !ok {
+		t.Error("expected service to outlive the lease")
+	}
+	// 已随租约过期的 key 删除时视为成功，不产生反注册告警
+	if err := other.DeleteRoute(ctx, "auth-0"); err != nil {
+		t.Errorf("expected deleting an expired route to succeed, got %v", err)
+	}
+
+	// 对已过期租约续约：重新创建租约并写回
+	if err := eb.keepAliveOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := keyLease(t, eb, routeKey)
+	if !ok || restored == lease || restored != eb.lease {
+		t.Fatalf("expected route restored on new lease %d, got %d ok=%v", eb.lease, restored, ok)
+	}
+	// 租约有效时续约不改变租约
+	if err := eb.keepAliveOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if eb.lease != restored {
+		t.Errorf("expected lease %d kept after keepalive, got %d", restored, eb.lease)
+	}
+
+	// 退出：解除租约的 key 保留，撤销租约后其余 key 立即删除
+	if err := client.RegisterRoute(ctx, NewRoute("auth-1", "auth", "/v1/logout")); err != nil {
+		t.Fatal(err)
+	}
+	if err := eb.Detach(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RegisterRoute(ctx, NewRoute("auth-2", "auth", "/v1/me")); err != nil {
+		t.Fatal(err)
+	}
+	if err := eb.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"auth-0", "auth-1"} {
+		if lease, ok := keyLease(t, eb, "/apisix/routes/"+id); !ok || lease != 0 {
+			t.Errorf("expected detached route %s kept without lease, got lease %d ok=%v", id, lease, ok)
+		}
+	}
+	if _, ok := keyLease(t, eb, "/apisix/routes/auth-2"); ok {
+		t.Error("expected auth-2 removed with the revoked lease")
+	}
+	if err := client.DeleteRoute(ctx, "auth-2"); err != nil {
+		t.Errorf("expected deleting a route removed with the lease to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeEtcd 模拟 etcd v3 JSON gateway 的 kv 与 lease 接口
+type fakeEtcd struct {
+	mu     sync.Mutex
+	rev    int64
+	kvs    map[string]fakeEtcdKV
+	leases map[int64]bool
+	grants int
+}
+
+type fakeEtcdKV struct {
+	value []byte
+	lease int64
+	mod   int64
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{kvs: map[string]fakeEtcdKV{}, leases: map[int64]bool{}}
+}
+
+// expire 模拟租约过期：删除租约及其绑定的 key
+func (f *fakeEtcd) expire(lease int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revoke(lease)
+}
+
+func (f *fakeEtcd) revoke(lease int64) {
+	delete(f.leases, lease)
+	for k, kv := range f.kvs {
+		if kv.lease == lease {
+			delete(f.kvs, k)
+		}
+	}
+}
+
+func (f *fakeEtcd) get(key string) (fakeEtcdKV, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	kv, ok := f.kvs[key]
+	return kv, ok
+}
+
+func decodeB64(s string) string {
+	b, _ := base64.StdEncoding.DecodeString(s)
+	return string(b)
+}
+
+func atoi64(v interface{}) int64 {
+	switch n := v.(type) {
+	case string:
+		i, _ := strconv.ParseInt(n, 10, 64)
+		return i
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+func (f *fakeEtcd) put(req map[string]interface{}) {
+	f.rev++
+	key := decodeB64(req["key"].(string))
+	value, _ := base64.StdEncoding.DecodeString(req["value"].(string))
+	f.kvs[key] = fakeEtcdKV{value: value, lease: atoi64(req["lease"]), mod: f.rev}
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&req)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var resp interface{} = map[string]interface{}{}
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		key := decodeB64(req["key"].(string))
+		end, _ := req["range_end"].(string)
+		var kvs []map[string]interface{}
+		for k, kv := range f.kvs {
+			if k == key || (end != "" && k >= key && k < decodeB64(end)) {
+				kvs = append(kvs, map[string]interface{}{
+					"key": base64.StdEncoding.EncodeToString([]byte(k)), "value": base64.StdEncoding.EncodeToString(kv.value),
+					"mod_revision": strconv.FormatInt(kv.mod, 10), "lease": strconv.FormatInt(kv.lease, 10),
+				})
+			}
+		}
+		if req["count_only"] == true {
+			resp = map[string]interface{}{"count": strconv.Itoa(len(kvs))}
+		} else {
+			resp = map[string]interface{}{"kvs": kvs, "count": strconv.Itoa(len(kvs))}
+		}
+	case "/v3/kv/put":
+		if l := atoi64(req["lease"]); l != 0 && !f.leases[l] {
+			http.Error(w, `{"error":"etcdserver: requested lease not found","code":5}`, http.StatusNotFound)
+			return
+		}
+		f.put(req)
+	case "/v3/kv/deleterange":
+		key := decodeB64(req["key"].(string))
+		_, ok := f.kvs[key]
+		delete(f.kvs, key)
+		if ok {
+			resp = map[string]interface{}{"deleted": "1"}
+		}
+	case "/v3/kv/txn":
+		cmp := req["compare"].([]interface{})[0].(map[string]interface{})
+		kv := f.kvs[decodeB64(cmp["key"].(string))]
+		if (cmp["target"] == "LEASE" && kv.lease != atoi64(cmp["lease"])) || (cmp["target"] == "MOD" && kv.mod != atoi64(cmp["mod_revision"])) {
+			resp = map[string]interface{}{"succeeded": false}
+			break
+		}
+		f.put(req["success"].([]interface{})[0].(map[string]interface{})["request_put"].(map[string]interface{}))
+		resp = map[string]interface{}{"succeeded": true}
+	case "/v3/lease/grant":
+		f.grants++
+		id := int64(100 + f.grants)
+		f.leases[id] = true
+		resp = map[string]interface{}{"ID": strconv.FormatInt(id, 10), "TTL": strconv.FormatInt(atoi64(req["TTL"]), 10)}
+	case "/v3/lease/keepalive":
+		id := atoi64(req["ID"])
+		result := map[string]interface{}{"ID": strconv.FormatInt(id, 10)}
+		if f.leases[id] {
+			result["TTL"] = "60"
+		}
+		resp = map[string]interface{}{"result": result}
+	case "/v3/lease/revoke":
+		f.revoke(atoi64(req["ID"]))
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestEtcdBackend(t *testing.T) {
+	etcd := newFakeEtcd()
+	ts := httptest.NewServer(etcd)
+	defer ts.Close()
+
+	cfg := &Config{Backend: "etcd", TTL: 60, Etcd: &EtcdSpec{Endpoints: []string{"http://127.0.0.1:1", ts.URL}}}
+	client := NewApisixClient(cfg)
+	eb, ok := client.Backend.(*EtcdBackend)
+	if !ok {
+		t.Fatalf("expected etcd backend, got %T", client.Backend)
+	}
+	ctx := context.Background()
+	if err := client.EnsureVersion(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewService("auth", "auth", "auth").WithPlugin("traffic-split", map[string]interface{}{"rules": []interface{}{}})
+	if err := client.RegisterService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RegisterRoute(ctx, NewRoute("auth-0", "auth", "/v1/login")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RegisterPluginMetadata(ctx, "http-logger", map[string]interface{}{"log_format": map[string]interface{}{"host": "$host"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PatchService(ctx, "auth", map[string]interface{}{"plugins": map[string]interface{}{"traffic-split": nil}}); err != nil {
+		t.Fatal(err)
+	}
+
+	route, ok := etcd.get("/apisix/routes/auth-0")
+	if !ok || route.lease == 0 {
+		t.Fatalf("expected leased route under /apisix/routes, got %+v", route)
+	}
+	if md, _ := etcd.get("/apisix/plugin_metadata/http-logger"); md.lease != 0 {
+		t.Errorf("expected plugin metadata without lease, got lease %d", md.lease)
+	}
+	got, err := client.GetService(ctx, "auth")
+	if err != nil || got.Plugins["traffic-split"] != nil {
+		t.Errorf("expected traffic-split removed by patch, got %+v err=%v", got, err)
+	}
+	routes, err := client.ListRoutes(ctx, nil)
+	if err != nil || len(routes) != 1 || routes[0].URI != "/v1/login" {
+		t.Errorf("expected one route, got %+v err=%v", routes, err)
+	}
+
+	// 租约过期后续约失败，重新创建租约并写回资源；过期期间删除已不存在的 key 视为成功
+	etcd.expire(route.lease)
+	if err := NewApisixClient(cfg).DeleteRoute(ctx, "auth-0"); err != nil {
+		t.Errorf("expected deleting an expired route to succeed, got %v", err)
+	}
+	if err := eb.keepAliveOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := etcd.get("/apisix/routes/auth-0")
+	if !ok || restored.lease == route.lease {
+		t.Fatalf("expected route restored with a new lease, got %+v", restored)
+	}
+	if svc, ok := etcd.get("/apisix/services/auth"); !ok || svc.lease != 0 {
+		t.Errorf("expected service kept without lease, got %+v", svc)
+	}
+
+	// PATCH 保留原有租约，不绑定到调用方的租约
+	other := NewApisixClient(cfg)
+	if _, err := other.doRequest(ctx, "PATCH", "/routes/auth-0", map[string]interface{}{"desc": "patched"}); err != nil {
+		t.Fatal(err)
+	}
+	if patched, _ := etcd.get("/apisix/routes/auth-0"); patched.lease != restored.lease {
+		t.Errorf("expected patch to keep lease %d, got %d", restored.lease, patched.lease)
+	}
+	if otherEB := other.Backend.(*EtcdBackend); otherEB.lease != 0 {
+		t.Errorf("expected patch not to grant a lease, got %d", otherEB.lease)
+	}
+
+	if err := client.DeleteRoute(ctx, "auth-0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetRoute(ctx, "auth-0"); !IsNotFound(err) {
+		t.Errorf("expected not found after delete, got %v", err)
+	}
+	if err := client.DeleteRoute(ctx, "auth-0"); err != nil {
+		t.Errorf("expected deleting a missing route to succeed, got %v", err)
+	}
+	if _, err := client.doRequest(ctx, "GET", "/schema/route", nil); err == nil {
+		t.Error("expected schema path to be unsupported")
+	}
+
+	// 退出：共享资源解除租约后保留，其余随租约撤销删除
+	if err := client.RegisterRoute(ctx, NewRoute("auth-1", "auth", "/v1/logout")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RegisterRoute(ctx, NewRoute("auth-2", "auth", "/v1/me")); err != nil {
+		t.Fatal(err)
+	}
+	eb.mu.Lock()
+	delete(eb.owned, "/apisix/routes/auth-2")
+	eb.mu.Unlock()
+	if err := eb.Detach(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := eb.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if kept, ok := etcd.get("/apisix/routes/auth-1"); !ok || kept.lease != 0 {
+		t.Errorf("expected detached route kept without lease, got %+v ok=%v", kept, ok)
+	}
+	if _, ok := etcd.get("/apisix/routes/auth-2"); ok {
+		t.Error("expected route removed with the revoked lease")
+	}
+}
@@ -0,0 +1,101 @@
+package apisixregistryagent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileSource 从 Prometheus file_sd 格式文件读取节点：
+//
+//	[{"targets": ["10.0.0.1:8082"], "labels": {"weight": "2"}}]
+//
+// 文件内容变化时（轮询比较）同步到 upstream，部署工具只需原子写入该文件
+type FileSource struct {
+	Path         string
+	PollInterval time.Duration
+}
+
+type fileSDGroup struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+func NewFileSource(spec *FileSourceSpec) (*FileSource, error) {
+	if spec.Path == "" {
+		return nil, fmt.Errorf("node source file: path is required")
+	}
+	s := &FileSource{Path: spec.Path, PollInterval: spec.PollInterval}
+	if s.PollInterval <= 0 {
+		s.PollInterval = 5 * time.Second
+	}
+	return s, nil
+}
+
+// parseFileSD 解析 file_sd 内容，JSON 作为 YAML 子集一并支持。
+// 没有任何 target 视为错误：非原子写入时文件可能暂时为空或被截断，不能据此清空 upstream
+func parseFileSD(data []byte) (map[string]int, error) {
+	var groups []fileSDGroup
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		return nil, err
+	}
+	nodes := map[string]int{}
+	for _, g := range groups {
+		weight := 1
+		if w, ok := g.Labels["weight"]; ok {
+			n, err := strconv.Atoi(w)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid weight label %q", w)
+			}
+			weight = n
+		}
+		for _, target := range g.Targets {
+			nodes[target] = weight
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no targets")
+	}
+	return nodes, nil
+}
+
+func (s *FileSource) Nodes(ctx context.Context) (map[string]int, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := parseFileSD(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", s.Path, err)
+	}
+	return nodes, nil
+}
+
+func (s *FileSource) Watch(ctx context.Context, update func(nodes map[string]int)) error {
+	var last []byte
+	for {
+		data, err := os.ReadFile(s.Path)
+		if err != nil {
+			log.Printf("[APISIX-AGENT][Warn] File source %s: %v", s.Path, err)
+		} else if last == nil || !bytes.Equal(data, last) {
+			// 解析失败或为空（写入中）时保留上一次的节点，等待文件修正
+			if nodes, err := parseFileSD(data); err != nil {
+				log.Printf("[APISIX-AGENT][Warn] File source parse %s: %v", s.Path, err)
+			} else {
+				update(nodes)
+			}
+			last = data
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSource_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.json")
+	os.WriteFile(path, []byte(`[{"targets": ["10.0.0.1:8082"]}]`), 0o644)
+
+	src, err := NewFileSource(&FileSourceSpec{Path: path, PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewFileSource error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var updates []map[string]int
+	src.Watch(ctx, func(nodes map[string]int) {
+		updates = append(updates, nodes)
+		if len(updates) == 1 {
+			// YAML 格式，带权重标签
+			os.WriteFile(path, []byte("- targets: [\"10.0.0.1:8082\", \"10.0.0.2:8082\"]\n  labels:\n    weight: \"2\"\n"), 0o644)
+		} else {
+			cancel()
+		}
+	})
+	if len(updates) != 2 {
+		t.Fatalf("expected 2 updates, got %d", len(updates))
+	}
+	if len(updates[0]) != 1 || updates[0]["10.0.0.1:8082"] != 1 {
+		t.Errorf("unexpected initial nodes: %v", updates[0])
+	}
+	if len(updates[1]) != 2 || updates[1]["10.0.0.2:8082"] != 2 {
+		t.Errorf("unexpected nodes after change: %v", updates[1])
+	}
+}
+
+func TestOpenNodeSource_NoPlaceholder(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	empty := filepath.Join(dir, "empty.json")
+	os.WriteFile(empty, []byte(`[{"targets": []}]`), 0o644)
+	for name, spec := range map[string]*NodeSourceSpec{
+		"unknown type": {Type: "zookeeper"},
+		"missing file": {Type: "file", File: &FileSourceSpec{Path: filepath.Join(dir, "missing.json")}},
+		"no nodes":     {Type: "file", File: &FileSourceSpec{Path: empty}},
+	} {
+		if _, _, err := openNodeSource(ctx, spec); err == nil {
+			t.Errorf("%s: expected error instead of falling back to placeholder nodes", name)
+		}
+	}
+
+	ok := filepath.Join(dir, "auth.json")
+	os.WriteFile(ok, []byte(`[{"targets": ["10.0.0.1:8082"]}]`), 0o644)
+	_, nodes, err := openNodeSource(ctx, &NodeSourceSpec{Type: "file", File: &FileSourceSpec{Path: ok}})
+	if err != nil || nodes["10.0.0.1:8082"] != 1 {
+		t.Errorf("unexpected nodes %v err=%v", nodes, err)
+	}
+}
+
+func TestFileSource_KeepLastGoodOnEmptyOrTruncated(t *testing.T) {
+	for _, data := range []string{"", "[]", `[{"targets": ["10.0.0.1:80`, "- targets: []\n"} {
+		if nodes, err := parseFileSD([]byte(data)); err == nil {
+			t.Errorf("expected error for %q, got %v", data, nodes)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "auth.json")
+	os.WriteFile(path, []byte(`[{"targets": ["10.0.0.1:8082"]}]`), 0o644)
+	src, _ := NewFileSource(&FileSourceSpec{Path: path, PollInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	writes := []string{"", `[{"targets": ["10.0.0.2:80`, `[{"targets": ["10.0.0.2:8082"]}]`}
+	var updates []map[string]int
+	src.Watch(ctx, func(nodes map[string]int) {
+		updates = append(updates, nodes)
+		if len(updates) == 2 {
+			cancel()
+			return
+		}
+		// 模拟非原子写入：先清空、再写入一半，最后写完
+		go func() {
+			for _, w := range writes {
+				os.WriteFile(path, []byte(w), 0o644)
+				time.Sleep(50 * time.Millisecond)
+			}
+		}()
+	})
+	if len(updates) != 2 || updates[1]["10.0.0.2:8082"] != 1 {
+		t.Fatalf("expected only complete node sets, got %v", updates)
+	}
+}
@@ -0,0 +1,208 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// APISIX 的 global_rule 不支持 labels，归属关系编码在 ID 中：{owner}.{id}，owner 为最后一个 "." 之前的部分。
+// 规则 id 不能包含 "."，这样 service_id 含 "." 时也不会冲突（auth 不会把 auth.v2.x 当作自己的规则）。
+// 每个 agent 只写入和删除自己的规则，APISIX 运行时合并所有全局规则的插件；
+// 同一插件已由其他 agent 的全局规则设置时跳过并报告冲突，避免重复执行或互相覆盖。
+// Admin API 没有跨资源的 CAS，两个 agent 可能同时通过检查并写入同一插件：
+// 写入后重新列出全局规则，由 ID 较小的规则保留该插件，另一方撤回（见 resolveGlobalRuleRaces）
+
+// globalRuleID 返回 owner 的全局规则 ID
+func globalRuleID(owner, id string) string {
+	return owner + "." + id
+}
+
+// ownedGlobalRule 判断全局规则是否属于 owner
+func ownedGlobalRule(owner, id string) bool {
+	i := strings.LastIndex(id, ".")
+	return i > 0 && id[:i] == owner
+}
+
+// checkGlobalRuleSpecs 拒绝会与其他 agent 的规则 ID 冲突的配置
+func checkGlobalRuleSpecs(owner string, specs []GlobalRuleSpec) error {
+	if owner == "" {
+		return fmt.Errorf("global rules: service_id is required")
+	}
+	for i, spec := range specs {
+		if spec.ID == "" || strings.Contains(spec.ID, ".") {
+			return fmt.Errorf("global_rules[%d]: id %q must be non-empty and must not contain '.'", i, spec.ID)
+		}
+	}
+	return nil
+}
+
+// GlobalRuleConflict 插件已由其他 agent 的全局规则设置
+type GlobalRuleConflict struct {
+	Plugin string
+	RuleID string // 本 agent 的规则
+	Owner  string // 已设置该插件的规则
+}
+
+func (c GlobalRuleConflict) Error() string {
+	return fmt.Sprintf("global plugin %s of rule %s already set by global rule %s", c.Plugin, c.RuleID, c.Owner)
+}
+
+// buildGlobalRules 生成 owner 的全局规则，剔除已由其他规则设置的插件
+func buildGlobalRules(owner string, specs []GlobalRuleSpec, existing []*GlobalRule) ([]*GlobalRule, []GlobalRuleConflict) {
+	taken := map[string]string{}
+	for _, rule := range existing {
+		if ownedGlobalRule(owner, rule.ID) {
+			continue
+		}
+		for name := range rule.Plugins {
+			taken[name] = rule.ID
+		}
+	}
+	var rules []*GlobalRule
+	var conflicts []GlobalRuleConflict
+	for _, spec := range specs {
+		rule := &GlobalRule{ID: globalRuleID(owner, spec.ID), Plugins: map[string]interface{}{}}
+		for _, p := range spec.Plugins {
+			if other, ok := taken[p.Name]; ok {
+				conflicts = append(conflicts, GlobalRuleConflict{Plugin: p.Name, RuleID: rule.ID, Owner: other})
+				continue
+			}
+			rule.Plugins[p.Name] = copyPluginConfig(p.Config)
+		}
+		if len(rule.Plugins) > 0 {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, conflicts
+}
+
+// resolveGlobalRuleRaces 检查写入后的全局规则，插件同时出现在其他 agent 的规则中时，
+// ID 较大的一方让出该插件，双方按同一规则判定，结果确定
+func resolveGlobalRuleRaces(owner string, written, current []*GlobalRule) ([]*GlobalRule, []GlobalRuleConflict) {
+	var changed []*GlobalRule
+	var conflicts []GlobalRuleConflict
+	for _, rule := range written {
+		var plugins map[string]interface{}
+		for _, other := range current {
+			if ownedGlobalRule(owner, other.ID) || other.ID > rule.ID {
+				continue
+			}
+			for name := range other.Plugins {
+				if _, ok := rule.Plugins[name]; !ok {
+					continue
+				}
+				if plugins == nil {
+					plugins = map[string]interface{}{}
+					for k, v := range rule.Plugins {
+						plugins[k] = v
+					}
+				}
+				if _, ok := plugins[name]; ok {
+					delete(plugins, name)
+					conflicts = append(conflicts, GlobalRuleConflict{Plugin: name, RuleID: rule.ID, Owner: other.ID})
+				}
+			}
+		}
+		if plugins != nil {
+			changed = append(changed, &GlobalRule{ID: rule.ID, Plugins: plugins})
+		}
+	}
+	return changed, conflicts
+}
+
+// RegisterGlobalRules 写入 owner 的全局规则，并删除配置中已移除的旧规则
+func RegisterGlobalRules(ctx context.Context, client *ApisixClient, validator *SchemaValidator, owner string, specs []GlobalRuleSpec) {
+	if err := checkGlobalRuleSpecs(owner, specs); err != nil {
+		log.Printf("[APISIX-AGENT] ERROR: %v", err)
+		return
+	}
+	existing, err := client.ListGlobalRules(ctx, nil)
+	if err != nil {
+		log.Printf("[APISIX-AGENT] ERROR: list global rules: %v", err)
+		return
+	}
+	rules, conflicts := buildGlobalRules(owner, specs, existing)
+	for _, c := range conflicts {
+		log.Printf("[APISIX-AGENT][Warn] Skip %v", c)
+	}
+	origins := map[string]map[string]string{}
+	for i, spec := range specs {
+		origins[globalRuleID(owner, spec.ID)] = pluginOrigins(spec.Plugins, fmt.Sprintf("global_rules[%d].plugins", i))
+	}
+	keep := map[string]bool{}
+	var written []*GlobalRule
+	for _, rule := range rules {
+		keep[rule.ID] = true
+		if !validatePayload(ctx, validator, "global_rule", rule.ID, rule, origins[rule.ID]) {
+			continue
+		}
+		if err := client.RegisterGlobalRule(ctx, rule); err != nil {
+			log.Printf("[APISIX-AGENT] RegisterGlobalRule failed: %v", resourceError("global_rule", rule.ID, err))
+		} else {
+			written = append(written, rule)
+			names := make([]string, 0, len(rule.Plugins))
+			for name := range rule.Plugins {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			log.Printf("[APISIX-AGENT] Global rule registered: %s %v", rule.ID, names)
+		}
+	}
+	if len(written) > 0 {
+		recheckGlobalRules(ctx, client, owner, written)
+	}
+	for _, rule := range existing {
+		if ownedGlobalRule(owner, rule.ID) && !keep[rule.ID] {
+			log.Printf("[APISIX-AGENT] Delete stale global rule: %s", rule.ID)
+			if err := client.DeleteGlobalRule(ctx, rule.ID); err != nil {
+				log.Printf("[APISIX-AGENT][Warn] DeleteGlobalRule error: %v", resourceError("global_rule", rule.ID, err))
+			}
+		}
+	}
+}
+
+// recheckGlobalRules 写入后重新列出全局规则，撤回与其他 agent 并发写入的重复插件
+func recheckGlobalRules(ctx context.Context, client *ApisixClient, owner string, written []*GlobalRule) {
+	current, err := client.ListGlobalRules(ctx, nil)
+	if err != nil {
+		log.Printf("[APISIX-AGENT][Warn] recheck global rules: %v", err)
+		return
+	}
+	changed, conflicts := resolveGlobalRuleRaces(owner, written, current)
+	for _, c := range conflicts {
+		log.Printf("[APISIX-AGENT][Warn] Withdraw %v", c)
+	}
+	for _, rule := range changed {
+		if len(rule.Plugins) == 0 {
+			err = client.DeleteGlobalRule(ctx, rule.ID)
+		} else {
+			err = client.RegisterGlobalRule(ctx, rule)
+		}
+		if err != nil {
+			log.Printf("[APISIX-AGENT][Warn] Withdraw global plugins failed: %v", resourceError("global_rule", rule.ID, err))
+		}
+	}
+}
+
+// DeleteGlobalRules 删除 owner 的全部全局规则，其他 agent 的规则不受影响
+func DeleteGlobalRules(ctx context.Context, client *ApisixClient, owner string) {
+	if owner == "" {
+		return
+	}
+	existing, err := client.ListGlobalRules(ctx, nil)
+	if err != nil {
+		log.Printf("[APISIX-AGENT][Warn] list global rules: %v", err)
+		return
+	}
+	for _, rule := range existing {
+		if !ownedGlobalRule(owner, rule.ID) {
+			continue
+		}
+		if err := client.DeleteGlobalRule(ctx, rule.ID); err != nil {
+			log.Printf("[APISIX-AGENT][Warn] DeleteGlobalRule error: %v", resourceError("global_rule", rule.ID, err))
+		}
+	}
+}
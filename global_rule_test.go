@@ -0,0 +1,150 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegisterGlobalRules_Ownership(t *testing.T) {
+	var mu sync.Mutex
+	rules := map[string]*GlobalRule{
+		"gateway.common": {ID: "gateway.common", Plugins: map[string]interface{}{"prometheus": map[string]interface{}{}}},
+		"auth.old":       {ID: "auth.old", Plugins: map[string]interface{}{"ip-restriction": map[string]interface{}{}}},
+		// service_id 为 auth.v2 的 agent 的规则，不属于 auth
+		"auth.v2.observability": {ID: "auth.v2.observability", Plugins: map[string]interface{}{"cors": map[string]interface{}{}}},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		id := strings.TrimPrefix(r.URL.Path, "/global_rules/")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/global_rules":
+			var list []map[string]interface{}
+			for _, rule := range rules {
+				list = append(list, map[string]interface{}{"key": "/apisix/global_rules/" + rule.ID, "value": rule})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"total": len(list), "list": list})
+		case r.Method == "PUT":
+			var rule GlobalRule
+			json.NewDecoder(r.Body).Decode(&rule)
+			rules[id] = &rule
+			w.Write([]byte(`{}`))
+		case r.Method == "DELETE":
+			delete(rules, id)
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	client := NewApisixClient(&Config{AdminAPI: srv.URL})
+	ctx := context.Background()
+	specs := []GlobalRuleSpec{{ID: "observability", Plugins: []PluginSpec{
+		{Name: "request-id", Config: map[string]interface{}{}},
+		{Name: "prometheus", Config: map[string]interface{}{"prefer_name": true}},
+	}}}
+	RegisterGlobalRules(ctx, client, nil, "auth", specs)
+
+	var ids []string
+	for id := range rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != "auth.observability,auth.v2.observability,gateway.common" {
+		t.Fatalf("expected stale auth.old removed and other owners untouched, got %v", ids)
+	}
+	own := rules["auth.observability"]
+	if own.Plugins["request-id"] == nil || own.Plugins["prometheus"] != nil {
+		t.Errorf("expected conflicting prometheus skipped: %+v", own.Plugins)
+	}
+
+	DeleteGlobalRules(ctx, client, "auth")
+	if len(rules) != 2 || rules["gateway.common"] == nil || rules["auth.v2.observability"] == nil {
+		t.Errorf("expected only other owner's rule left, got %v", rules)
+	}
+}
+
+func TestRegisterGlobalRules_ConcurrentWriters(t *testing.T) {
+	var mu sync.Mutex
+	rules := map[string]*GlobalRule{}
+	// 模拟另一个 agent 在本 agent 列出规则之后写入同一插件
+	racer := &GlobalRule{ID: "auth.observability", Plugins: map[string]interface{}{"prometheus": map[string]interface{}{}}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		id := strings.TrimPrefix(r.URL.Path, "/global_rules/")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/global_rules":
+			var list []map[string]interface{}
+			for _, rule := range rules {
+				list = append(list, map[string]interface{}{"key": "/apisix/global_rules/" + rule.ID, "value": rule})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"total": len(list), "list": list})
+		case r.Method == "PUT":
+			var rule GlobalRule
+			json.NewDecoder(r.Body).Decode(&rule)
+			rules[id] = &rule
+			rules[racer.ID] = racer
+			w.Write([]byte(`{}`))
+		case r.Method == "DELETE":
+			delete(rules, id)
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	client := NewApisixClient(&Config{AdminAPI: srv.URL})
+	specs := []GlobalRuleSpec{{ID: "observability", Plugins: []PluginSpec{
+		{Name: "request-id", Config: map[string]interface{}{}},
+		{Name: "prometheus", Config: map[string]interface{}{}},
+	}}}
+	RegisterGlobalRules(context.Background(), client, nil, "order", specs)
+
+	own := rules["order.observability"]
+	if own == nil || own.Plugins["request-id"] == nil || own.Plugins["prometheus"] != nil {
+		t.Fatalf("expected order to withdraw prometheus taken by auth.observability, got %+v", own)
+	}
+	if rules[racer.ID].Plugins["prometheus"] == nil {
+		t.Error("expected the rule with the smaller id to keep prometheus")
+	}
+
+	// 双方按同一规则判定：ID 较小的一方保留插件
+	written := []*GlobalRule{{ID: "auth.observability", Plugins: map[string]interface{}{"prometheus": map[string]interface{}{}}}}
+	current := []*GlobalRule{written[0], {ID: "order.observability", Plugins: map[string]interface{}{"prometheus": map[string]interface{}{}}}}
+	if changed, conflicts := resolveGlobalRuleRaces("auth", written, current); len(changed) != 0 || len(conflicts) != 0 {
+		t.Errorf("expected auth to keep prometheus, got %v %v", changed, conflicts)
+	}
+	changed, conflicts := resolveGlobalRuleRaces("order", current[1:], current)
+	if len(changed) != 1 || len(changed[0].Plugins) != 0 || len(conflicts) != 1 || conflicts[0].Owner != "auth.observability" {
+		t.Errorf("expected order to withdraw its only plugin, got %v %v", changed, conflicts)
+	}
+}
+
+func TestGlobalRuleOwnership(t *testing.T) {
+	cases := []struct {
+		owner, id string
+		want      bool
+	}{
+		{"auth", "auth.observability", true},
+		{"auth", "auth.v2.observability", false},
+		{"auth.v2", "auth.v2.observability", true},
+		{"auth", "authx.observability", false},
+		{"auth", "auth", false},
+	}
+	for _, c := range cases {
+		if got := ownedGlobalRule(c.owner, c.id); got != c.want {
+			t.Errorf("ownedGlobalRule(%q, %q) = %v, want %v", c.owner, c.id, got, c.want)
+		}
+	}
+	if err := checkGlobalRuleSpecs("auth", []GlobalRuleSpec{{ID: "v2.observability"}}); err == nil {
+		t.Error("expected rule id containing '.' rejected")
+	}
+	if err := checkGlobalRuleSpecs("auth.v2", []GlobalRuleSpec{{ID: "observability"}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
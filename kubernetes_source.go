@@ -0,0 +1,262 @@
+package apisixregistryagent
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultKubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	defaultKubernetesCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// KubernetesSource 通过 Kubernetes API（plain REST）list/watch EndpointSlice，
+// 将 ready 的 Pod 地址作为 upstream 节点
+type KubernetesSource struct {
+	APIServer     string
+	Namespace     string
+	Service       string
+	PortName      string
+	Port          int
+	Weight        int
+	TokenFile     string
+	HTTPClient    *http.Client
+	RetryInterval time.Duration
+}
+
+// endpointSlice 仅包含同步节点所需的 EndpointSlice 字段
+type endpointSlice struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+	} `json:"endpoints"`
+	Ports []struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	} `json:"ports"`
+}
+
+type endpointSliceList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []endpointSlice `json:"items"`
+}
+
+type endpointSliceEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+func NewKubernetesSource(spec *KubernetesSourceSpec) (*KubernetesSource, error) {
+	if spec.Service == "" {
+		return nil, fmt.Errorf("node source kubernetes: service is required")
+	}
+	s := &KubernetesSource{
+		APIServer:     spec.APIServer,
+		Namespace:     spec.Namespace,
+		Service:       spec.Service,
+		PortName:      spec.PortName,
+		Port:          spec.Port,
+		Weight:        spec.Weight,
+		TokenFile:     spec.TokenFile,
+		RetryInterval: 5 * time.Second,
+	}
+	caFile := spec.CAFile
+	if s.Namespace == "" {
+		s.Namespace = "default"
+	}
+	if s.Weight <= 0 {
+		s.Weight = 1
+	}
+	if s.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("node source kubernetes: api_server is required outside the cluster")
+		}
+		s.APIServer = "https://" + net.JoinHostPort(host, port)
+		if s.TokenFile == "" {
+			s.TokenFile = defaultKubernetesTokenFile
+		}
+		if caFile == "" {
+			caFile = defaultKubernetesCAFile
+		}
+	}
+	s.HTTPClient = &http.Client{}
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("node source kubernetes: read ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("node source kubernetes: no certificates in %s", caFile)
+		}
+		s.HTTPClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	return s, nil
+}
+
+func (s *KubernetesSource) slicesURL(query url.Values) string {
+	query.Set("labelSelector", "kubernetes.io/service-name="+s.Service)
+	return fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?%s",
+		strings.TrimRight(s.APIServer, "/"), url.PathEscape(s.Namespace), query.Encode())
+}
+
+func (s *KubernetesSource) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	// token 每次请求重新读取，兼容 projected token 轮换
+	if s.TokenFile != "" {
+		token, err := os.ReadFile(s.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read kubernetes token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("kubernetes api %s: status=%d", u, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func (s *KubernetesSource) list(ctx context.Context) (*endpointSliceList, error) {
+	resp, err := s.get(ctx, s.slicesURL(url.Values{}))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var list endpointSliceList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("decode endpointslices: %w", err)
+	}
+	return &list, nil
+}
+
+// nodesFromSlices 汇总所有 EndpointSlice 中 ready 的地址
+func (s *KubernetesSource) nodesFromSlices(slices map[string]endpointSlice) map[string]int {
+	nodes := map[string]int{}
+	for _, slice := range slices {
+		port := 0
+		for _, p := range slice.Ports {
+			if (s.PortName != "" && p.Name == s.PortName) || (s.PortName == "" && (s.Port == 0 || p.Port == s.Port)) {
+				port = p.Port
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			// ready 为空时按 Kubernetes 约定视为 ready
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, addr := range ep.Addresses {
+				nodes[net.JoinHostPort(addr, strconv.Itoa(port))] = s.Weight
+			}
+		}
+	}
+	return nodes
+}
+
+func (s *KubernetesSource) Nodes(ctx context.Context) (map[string]int, error) {
+	list, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slices := map[string]endpointSlice{}
+	for _, item := range list.Items {
+		slices[item.Metadata.Name] = item
+	}
+	return s.nodesFromSlices(slices), nil
+}
+
+func (s *KubernetesSource) Watch(ctx context.Context, update func(nodes map[string]int)) error {
+	for {
+		if err := s.listAndWatch(ctx, update); err != nil && ctx.Err() == nil {
+			log.Printf("[APISIX-AGENT][Warn] Kubernetes watch %s/%s: %v", s.Namespace, s.Service, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.RetryInterval):
+		}
+	}
+}
+
+// listAndWatch 先 list 全量，再从 resourceVersion 开始 watch，直到连接断开或出错
+func (s *KubernetesSource) listAndWatch(ctx context.Context, update func(nodes map[string]int)) error {
+	list, err := s.list(ctx)
+	if err != nil {
+		return err
+	}
+	slices := map[string]endpointSlice{}
+	for _, item := range list.Items {
+		slices[item.Metadata.Name] = item
+	}
+	update(s.nodesFromSlices(slices))
+
+	query := url.Values{}
+	query.Set("watch", "1")
+	query.Set("allowWatchBookmarks", "true")
+	query.Set("resourceVersion", list.Metadata.ResourceVersion)
+	resp, err := s.get(ctx, s.slicesURL(query))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var ev endpointSliceEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return fmt.Errorf("decode watch event: %w", err)
+		}
+		switch ev.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+			var slice endpointSlice
+			if err := json.Unmarshal(ev.Object, &slice); err != nil {
+				return fmt.Errorf("decode endpointslice: %w", err)
+			}
+			if ev.Type == "DELETED" {
+				delete(slices, slice.Metadata.Name)
+			} else {
+				slices[slice.Metadata.Name] = slice
+			}
+			update(s.nodesFromSlices(slices))
+		case "ERROR":
+			// 通常为 410 Gone（resourceVersion 过期），重新 list
+			return fmt.Errorf("watch error: %s", string(ev.Object))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("watch closed")
+}
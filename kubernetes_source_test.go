@@ -0,0 +1,62 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKubernetesSource_ListAndWatch(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/default/endpointslices" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=auth" {
+			t.Errorf("unexpected labelSelector: %s", r.URL.RawQuery)
+		}
+		if r.URL.Query().Get("watch") == "" {
+			fmt.Fprint(w, `{"metadata":{"resourceVersion":"10"},"items":[
+				{"metadata":{"name":"auth-abc"},
+				 "endpoints":[{"addresses":["10.0.0.1"],"conditions":{"ready":true}},
+				              {"addresses":["10.0.0.2"],"conditions":{"ready":false}}],
+				 "ports":[{"name":"http","port":8080},{"name":"grpc","port":8082}]}]}`)
+			return
+		}
+		if r.URL.Query().Get("resourceVersion") != "10" {
+			t.Errorf("unexpected resourceVersion: %s", r.URL.RawQuery)
+		}
+		fmt.Fprintln(w, `{"type":"MODIFIED","object":{"metadata":{"name":"auth-abc"},"endpoints":[{"addresses":["10.0.0.1"]},{"addresses":["10.0.0.2"],"conditions":{"ready":true}}],"ports":[{"name":"grpc","port":8082}]}}`)
+	}))
+	defer api.Close()
+
+	src, err := NewKubernetesSource(&KubernetesSourceSpec{APIServer: api.URL, Service: "auth", PortName: "grpc"})
+	if err != nil {
+		t.Fatalf("NewKubernetesSource error: %v", err)
+	}
+	nodes, err := src.Nodes(context.Background())
+	if err != nil {
+		t.Fatalf("Nodes error: %v", err)
+	}
+	if len(nodes) != 1 || nodes["10.0.0.1:8082"] != 1 {
+		t.Errorf("unexpected initial nodes: %v", nodes)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var updates []map[string]int
+	src.Watch(ctx, func(nodes map[string]int) {
+		updates = append(updates, nodes)
+		if len(updates) == 2 {
+			cancel()
+		}
+	})
+	if len(updates) < 2 {
+		t.Fatalf("expected at least 2 updates, got %d", len(updates))
+	}
+	if last := updates[1]; len(last) != 2 || last["10.0.0.2:8082"] != 1 {
+		t.Errorf("unexpected nodes after watch event: %v", last)
+	}
+}
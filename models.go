@@ -0,0 +1,228 @@
+package apisixregistryagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// APISIX v3 Admin API 资源模型，字段均为 omitempty，未设置的字段不会写入 APISIX
+
+// Route /routes 资源
+type Route struct {
+	ID              string                 `json:"id,omitempty"`
+	Name            string                 `json:"name,omitempty"`
+	Desc            string                 `json:"desc,omitempty"`
+	URI             string                 `json:"uri,omitempty"`
+	URIs            []string               `json:"uris,omitempty"`
+	Methods         []string               `json:"methods,omitempty"`
+	Hosts           []string               `json:"hosts,omitempty"`
+	RemoteAddrs     []string               `json:"remote_addrs,omitempty"`
+	Vars            []interface{}          `json:"vars,omitempty"`
+	FilterFunc      string                 `json:"filter_func,omitempty"`
+	Priority        int                    `json:"priority,omitempty"`
+	Timeout         *Timeout               `json:"timeout,omitempty"`
+	EnableWebsocket bool                   `json:"enable_websocket,omitempty"`
+	Status          *int                   `json:"status,omitempty"`
+	ServiceID       string                 `json:"service_id,omitempty"`
+	UpstreamID      string                 `json:"upstream_id,omitempty"`
+	PluginConfigID  string                 `json:"plugin_config_id,omitempty"`
+	Plugins         map[string]interface{} `json:"plugins,omitempty"`
+	Labels          map[string]string      `json:"labels,omitempty"`
+}
+
+// Timeout 路由/upstream 超时（秒）
+type Timeout struct {
+	Connect float64 `json:"connect,omitempty"`
+	Send    float64 `json:"send,omitempty"`
+	Read    float64 `json:"read,omitempty"`
+}
+
+// Service /services 资源
+type Service struct {
+	ID              string                 `json:"id,omitempty"`
+	Name            string                 `json:"name,omitempty"`
+	Desc            string                 `json:"desc,omitempty"`
+	UpstreamID      string                 `json:"upstream_id,omitempty"`
+	Hosts           []string               `json:"hosts,omitempty"`
+	EnableWebsocket bool                   `json:"enable_websocket,omitempty"`
+	Plugins         map[string]interface{} `json:"plugins,omitempty"`
+	Labels          map[string]string      `json:"labels,omitempty"`
+}
+
+// Upstream /upstreams 资源，nodes 与 discovery_type/service_name 二选一
+type Upstream struct {
+	ID            string            `json:"id,omitempty"`
+	Name          string            `json:"name,omitempty"`
+	Desc          string            `json:"desc,omitempty"`
+	Type          string            `json:"type,omitempty"`
+	Scheme        string            `json:"scheme,omitempty"`
+	Nodes         map[string]int    `json:"nodes,omitempty"`
+	DiscoveryType string            `json:"discovery_type,omitempty"`
+	ServiceName   string            `json:"service_name,omitempty"`
+	PassHost      string            `json:"pass_host,omitempty"`
+	UpstreamHost  string            `json:"upstream_host,omitempty"`
+	TLS           *UpstreamTLS      `json:"tls,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+}
+
+// upstreamNode nodes 的数组形式（dashboard、ingress controller 写入）
+type upstreamNode struct {
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	Weight int    `json:"weight"`
+}
+
+// UnmarshalJSON nodes 同时支持 {"host:port": weight} 与 [{"host","port","weight"}] 两种形式，
+// 数组形式转换为 map（priority 等字段不保留）
+func (u *Upstream) UnmarshalJSON(data []byte) error {
+	type plain Upstream
+	raw := struct {
+		*plain
+		Nodes json.RawMessage `json:"nodes,omitempty"`
+	}{plain: (*plain)(u)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	u.Nodes = nil
+	if len(raw.Nodes) == 0 || string(raw.Nodes) == "null" {
+		return nil
+	}
+	if raw.Nodes[0] != '[' {
+		return json.Unmarshal(raw.Nodes, &u.Nodes)
+	}
+	var nodes []upstreamNode
+	if err := json.Unmarshal(raw.Nodes, &nodes); err != nil {
+		return fmt.Errorf("upstream nodes: %w", err)
+	}
+	u.Nodes = make(map[string]int, len(nodes))
+	for _, n := range nodes {
+		addr := n.Host
+		if n.Port > 0 {
+			addr = net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+		}
+		u.Nodes[addr] = n.Weight
+	}
+	return nil
+}
+
+// UpstreamTLS upstream.tls，client_cert/client_key 与 client_cert_id 二选一
+type UpstreamTLS struct {
+	ClientCert   string `json:"client_cert,omitempty"`
+	ClientKey    string `json:"client_key,omitempty"`
+	ClientCertID string `json:"client_cert_id,omitempty"`
+	Verify       *bool  `json:"verify,omitempty"`
+}
+
+// Consumer /consumers 资源
+type Consumer struct {
+	Username string                 `json:"username"`
+	Desc     string                 `json:"desc,omitempty"`
+	Plugins  map[string]interface{} `json:"plugins,omitempty"`
+	Labels   map[string]string      `json:"labels,omitempty"`
+}
+
+// Proto /protos 资源，content 为 proto 文本或 base64 编码的 descriptor
+type Proto struct {
+	ID      string `json:"id,omitempty"`
+	Desc    string `json:"desc,omitempty"`
+	Content string `json:"content"`
+}
+
+// PluginConfig /plugin_configs 资源，路由中同名插件的配置优先
+type PluginConfig struct {
+	ID      string                 `json:"id,omitempty"`
+	Desc    string                 `json:"desc,omitempty"`
+	Plugins map[string]interface{} `json:"plugins"`
+	Labels  map[string]string      `json:"labels,omitempty"`
+}
+
+// StreamRoute /stream_routes 资源，upstream 与 upstream_id 二选一
+type StreamRoute struct {
+	ID         string                 `json:"id,omitempty"`
+	Desc       string                 `json:"desc,omitempty"`
+	ServerAddr string                 `json:"server_addr,omitempty"`
+	ServerPort int                    `json:"server_port,omitempty"`
+	RemoteAddr string                 `json:"remote_addr,omitempty"`
+	SNI        string                 `json:"sni,omitempty"`
+	UpstreamID string                 `json:"upstream_id,omitempty"`
+	Upstream   *Upstream              `json:"upstream,omitempty"`
+	Plugins    map[string]interface{} `json:"plugins,omitempty"`
+}
+
+// GlobalRule /global_rules 资源，schema 不允许 labels 等其他字段
+type GlobalRule struct {
+	ID      string                 `json:"id"`
+	Plugins map[string]interface{} `json:"plugins"`
+}
+
+// SSL /ssls 资源，client 用于开启客户端证书校验（mTLS）
+type SSL struct {
+	ID     string            `json:"id,omitempty"`
+	Cert   string            `json:"cert"`
+	Key    string            `json:"key"`
+	SNIs   []string          `json:"snis,omitempty"`
+	Client *SSLClient        `json:"client,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// SSLClient ssl.client
+type SSLClient struct {
+	CA    string `json:"ca"`
+	Depth int    `json:"depth,omitempty"`
+}
+
+// NewRoute 创建挂在 service 下的路由
+func NewRoute(id, serviceID, uri string) *Route {
+	return &Route{ID: id, Name: id, ServiceID: serviceID, URI: uri}
+}
+
+// WithPluginConfig 引用 /plugin_configs 中的插件组
+func (r *Route) WithPluginConfig(id string) *Route {
+	r.PluginConfigID = id
+	return r
+}
+
+// WithMethods 设置 HTTP 方法
+func (r *Route) WithMethods(methods ...string) *Route {
+	r.Methods = methods
+	return r
+}
+
+// WithPlugin 添加插件配置
+func (r *Route) WithPlugin(name string, config map[string]interface{}) *Route {
+	if r.Plugins == nil {
+		r.Plugins = map[string]interface{}{}
+	}
+	r.Plugins[name] = config
+	return r
+}
+
+// NewService 创建指向 upstream 的 service
+func NewService(id, name, upstreamID string) *Service {
+	return &Service{ID: id, Name: name, UpstreamID: upstreamID}
+}
+
+// WithPlugin 添加插件配置
+func (s *Service) WithPlugin(name string, config map[string]interface{}) *Service {
+	if s.Plugins == nil {
+		s.Plugins = map[string]interface{}{}
+	}
+	s.Plugins[name] = config
+	return s
+}
+
+// NewConsumer 创建 consumer
+func NewConsumer(username string) *Consumer {
+	return &Consumer{Username: username}
+}
+
+// WithPlugin 添加鉴权插件配置
+func (c *Consumer) WithPlugin(name string, config map[string]interface{}) *Consumer {
+	if c.Plugins == nil {
+		c.Plugins = map[string]interface{}{}
+	}
+	c.Plugins[name] = config
+	return c
+}
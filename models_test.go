@@ -0,0 +1,162 @@
+package apisixregistryagent
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRoute_JSON(t *testing.T) {
+	route := NewRoute("auth-0", "auth", "/v1/login").
+		WithMethods("POST").
+		WithPlugin("grpc-transcode", map[string]interface{}{"method": "Login"})
+	data, err := json.Marshal(route)
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	want := `{"id":"auth-0","name":"auth-0","uri":"/v1/login","methods":["POST"],"service_id":"auth","plugins":{"grpc-transcode":{"method":"Login"}}}`
+	if string(data) != want {
+		t.Errorf("unexpected route json:\n got: %s\nwant: %s", data, want)
+	}
+}
+
+func TestUpstream_NodesForms(t *testing.T) {
+	var up Upstream
+	if err := json.Unmarshal([]byte(`{"id":"auth","type":"roundrobin","nodes":{"10.0.0.1:8082":1}}`), &up); err != nil {
+		t.Fatal(err)
+	}
+	if up.ID != "auth" || up.Nodes["10.0.0.1:8082"] != 1 {
+		t.Errorf("unexpected upstream from map nodes: %+v", up)
+	}
+	// dashboard / ingress controller 写入的数组形式
+	var list []StreamRoute
+	data := `[{"id":"redis","upstream":{"type":"roundrobin","nodes":[{"host":"10.0.0.2","port":6379,"weight":2,"priority":0},{"host":"::1","port":6380,"weight":1}]}}]`
+	if err := json.Unmarshal([]byte(data), &list); err != nil {
+		t.Fatal(err)
+	}
+	nodes := list[0].Upstream.Nodes
+	if len(nodes) != 2 || nodes["10.0.0.2:6379"] != 2 || nodes["[::1]:6380"] != 1 || list[0].Upstream.Type != "roundrobin" {
+		t.Errorf("unexpected nodes from array form: %+v", list[0].Upstream)
+	}
+}
+
+func TestBuildProtoRoute(t *testing.T) {
+	cfg := &Config{RoutePlugins: []PluginSpec{
+		{Name: "grpc-transcode", Config: map[string]interface{}{"proto_id": "auth"}},
+	}}
+	r := map[string]interface{}{"uri": "/v1/login", "methods": []string{"POST"}, "grpc_method": "Login"}
+	route := buildProtoRoute(cfg, "auth", "auth-0", r)
+	gt := route.Plugins["grpc-transcode"].(map[string]interface{})
+	if gt["method"] != "Login" || gt["proto_id"] != "auth" {
+		t.Errorf("unexpected grpc-transcode config: %+v", gt)
+	}
+	if _, ok := cfg.RoutePlugins[0].Config["method"]; ok {
+		t.Errorf("route plugin template must not be modified")
+	}
+}
+
+func TestPluginConfigReference(t *testing.T) {
+	cfg := &Config{
+		RoutePluginConfig: "auth-common",
+		RoutePlugins:      []PluginSpec{{Name: "grpc-transcode", Config: map[string]interface{}{"proto_id": "auth"}}},
+		PluginConfigs: []PluginConfigSpec{{ID: "auth-common", Plugins: []PluginSpec{
+			{Name: "multi-auth", Config: map[string]interface{}{"auth_plugins": []interface{}{"jwt-auth"}}},
+		}}},
+	}
+	pc := buildPluginConfig("auth", cfg.PluginConfigs[0])
+	if pc.ID != "auth.auth-common" || pc.Plugins["multi-auth"] == nil {
+		t.Errorf("unexpected plugin config: %+v", pc)
+	}
+
+	r := map[string]interface{}{"uri": "/v1/login", "grpc_method": "Login"}
+	route := buildProtoRoute(cfg, "auth", "auth-0", r)
+	if route.PluginConfigID != "auth.auth-common" || route.Plugins["multi-auth"] != nil {
+		t.Errorf("expected route to reference plugin config instead of copying it: %+v", route)
+	}
+	custom := buildCustomRoute(cfg, "auth", "auth-1", r, RouteConfig{URI: "/v1/login", PluginConfig: "auth-public"})
+	if custom.PluginConfigID != "auth.auth-public" {
+		t.Errorf("expected custom route plugin_config auth.auth-public, got %q", custom.PluginConfigID)
+	}
+}
+
+func TestBuildService(t *testing.T) {
+	cfg := &Config{ServiceName: "auth", Service: &ServiceSpec{
+		Hosts:           []string{"api.example.com"},
+		EnableWebsocket: true,
+		Labels:          map[string]string{"team": "identity"},
+		Plugins:         []PluginSpec{{Name: "request-id", Config: map[string]interface{}{"header_name": "X-Request-Id"}}},
+	}}
+	svc := buildService(cfg, "auth", "auth")
+	data, err := json.Marshal(svc)
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	want := `{"id":"auth","name":"auth","desc":"Auto registered by apisix-registry-agent","upstream_id":"auth","hosts":["api.example.com"],"enable_websocket":true,"plugins":{"request-id":{"header_name":"X-Request-Id"}},"labels":{"team":"identity"}}`
+	if string(data) != want {
+		t.Errorf("unexpected service json:\n got: %s\nwant: %s", data, want)
+	}
+}
+
+func TestRouteMatchOptions(t *testing.T) {
+	var cfg Config
+	err := yaml.Unmarshal([]byte(`
+route_defaults:
+  hosts: ["api.example.com"]
+  timeout: {connect: 3, send: 10, read: 10}
+routes:
+  - uri: /v1/admin
+    uris: ["/v1/admin/*"]
+    remote_addrs: ["10.0.0.0/8"]
+    vars: [["http_x_env", "==", "prod"]]
+    priority: 10
+    status: 0
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := map[string]interface{}{"uri": "/v1/admin", "grpc_method": "Admin"}
+	route := buildCustomRoute(&cfg, "auth", "auth-0", r, cfg.Routes[0])
+	data, _ := json.Marshal(route)
+	want := `{"id":"auth-0","name":"auth-0","desc":"Auto registered by apisix-registry-agent (custom config)","uris":["/v1/admin","/v1/admin/*"],"hosts":["api.example.com"],"remote_addrs":["10.0.0.0/8"],"vars":[["http_x_env","==","prod"]],"priority":10,"timeout":{"connect":3,"send":10,"read":10},"status":0,"service_id":"auth"}`
+	if string(data) != want {
+		t.Errorf("unexpected custom route json:\n got: %s\nwant: %s", data, want)
+	}
+
+	proto := buildProtoRoute(&cfg, "auth", "auth-1", map[string]interface{}{"uri": "/v1/login"})
+	if len(proto.Hosts) != 1 || proto.Timeout == nil || proto.Status != nil || proto.Priority != 0 {
+		t.Errorf("expected proto route to get route_defaults only: %+v", proto)
+	}
+}
+
+func TestRouteMatchOptions_PartialTimeoutAndWebsocket(t *testing.T) {
+	var cfg Config
+	err := yaml.Unmarshal([]byte(`
+route_defaults:
+  timeout: {read: 30}
+  enable_websocket: true
+routes:
+  - uri: /v1/login
+    timeout: {connect: 5}
+    enable_websocket: false
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未设置的项取 route_defaults，其余取 APISIX 默认 60 秒
+	proto := buildProtoRoute(&cfg, "auth", "auth-0", map[string]interface{}{"uri": "/v1/me"})
+	if proto.Timeout == nil || *proto.Timeout != (Timeout{Connect: 60, Send: 60, Read: 30}) || !proto.EnableWebsocket {
+		t.Errorf("unexpected proto route timeout/websocket: %+v %v", proto.Timeout, proto.EnableWebsocket)
+	}
+	custom := buildCustomRoute(&cfg, "auth", "auth-1", map[string]interface{}{"uri": "/v1/login"}, cfg.Routes[0])
+	if custom.Timeout == nil || *custom.Timeout != (Timeout{Connect: 5, Send: 60, Read: 30}) {
+		t.Errorf("unexpected custom route timeout: %+v", custom.Timeout)
+	}
+	if custom.EnableWebsocket {
+		t.Error("expected route to turn off websocket enabled by route_defaults")
+	}
+	data, _ := json.Marshal(custom.Timeout)
+	if string(data) != `{"connect":5,"send":60,"read":30}` {
+		t.Errorf("unexpected timeout json: %s", data)
+	}
+}
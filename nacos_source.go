@@ -0,0 +1,171 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NacosSource 通过 Nacos naming open API 查询健康实例，按 PollInterval 轮询变化。
+// open API 没有长轮询/订阅接口（推送走 UDP 或 2.x 的 gRPC），变化最多延迟一个 PollInterval
+type NacosSource struct {
+	Address      string
+	Service      string
+	Namespace    string
+	Group        string
+	Clusters     string
+	Username     string
+	Password     string
+	PollInterval time.Duration
+	HTTPClient   *http.Client
+
+	accessToken string
+	tokenExpiry time.Time
+}
+
+type nacosInstanceList struct {
+	Hosts []struct {
+		IP      string  `json:"ip"`
+		Port    int     `json:"port"`
+		Weight  float64 `json:"weight"`
+		Healthy bool    `json:"healthy"`
+		Enabled bool    `json:"enabled"`
+	} `json:"hosts"`
+}
+
+func NewNacosSource(spec *NacosSourceSpec) (*NacosSource, error) {
+	if spec.Address == "" || spec.Service == "" {
+		return nil, fmt.Errorf("node source nacos: address and service are required")
+	}
+	s := &NacosSource{
+		Address:      strings.TrimRight(spec.Address, "/"),
+		Service:      spec.Service,
+		Namespace:    spec.Namespace,
+		Group:        spec.Group,
+		Clusters:     spec.Clusters,
+		Username:     spec.Username,
+		Password:     spec.Password,
+		PollInterval: spec.PollInterval,
+		HTTPClient:   &http.Client{},
+	}
+	if s.PollInterval <= 0 {
+		s.PollInterval = 10 * time.Second
+	}
+	return s, nil
+}
+
+// login 开启鉴权时获取 accessToken，过期前复用
+func (s *NacosSource) login(ctx context.Context) (string, error) {
+	if s.Username == "" {
+		return "", nil
+	}
+	if s.accessToken != "" && time.Now().Before(s.tokenExpiry) {
+		return s.accessToken, nil
+	}
+	form := url.Values{}
+	form.Set("username", s.Username)
+	form.Set("password", s.Password)
+	req, err := http.NewRequestWithContext(ctx, "POST", s.Address+"/nacos/v1/auth/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("nacos login: status=%d", resp.StatusCode)
+	}
+	var data struct {
+		AccessToken string `json:"accessToken"`
+		TokenTTL    int64  `json:"tokenTtl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", fmt.Errorf("decode nacos login response: %w", err)
+	}
+	s.accessToken = data.AccessToken
+	// 提前 10% 刷新
+	s.tokenExpiry = time.Now().Add(time.Duration(data.TokenTTL) * time.Second * 9 / 10)
+	return s.accessToken, nil
+}
+
+func (s *NacosSource) Nodes(ctx context.Context) (map[string]int, error) {
+	token, err := s.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	q.Set("serviceName", s.Service)
+	q.Set("healthyOnly", "true")
+	if s.Namespace != "" {
+		q.Set("namespaceId", s.Namespace)
+	}
+	if s.Group != "" {
+		q.Set("groupName", s.Group)
+	}
+	if s.Clusters != "" {
+		q.Set("clusters", s.Clusters)
+	}
+	if token != "" {
+		q.Set("accessToken", token)
+	}
+	u := s.Address + "/nacos/v1/ns/instance/list?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("nacos instance list %s: status=%d", s.Service, resp.StatusCode)
+	}
+	var list nacosInstanceList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("decode nacos response: %w", err)
+	}
+	nodes := map[string]int{}
+	for _, h := range list.Hosts {
+		if !h.Healthy || !h.Enabled {
+			continue
+		}
+		// Nacos 权重为浮点数，APISIX 需要整数
+		weight := int(math.Round(h.Weight))
+		if weight <= 0 && h.Weight > 0 {
+			weight = 1
+		}
+		nodes[net.JoinHostPort(h.IP, strconv.Itoa(h.Port))] = weight
+	}
+	return nodes, nil
+}
+
+func (s *NacosSource) Watch(ctx context.Context, update func(nodes map[string]int)) error {
+	for {
+		nodes, err := s.Nodes(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("[APISIX-AGENT][Warn] Nacos watch %s: %v", s.Service, err)
+		} else {
+			update(nodes)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
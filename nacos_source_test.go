@@ -0,0 +1,42 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNacosSource_Nodes(t *testing.T) {
+	nacos := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nacos/v1/auth/login":
+			fmt.Fprint(w, `{"accessToken":"token-1","tokenTtl":18000}`)
+		case "/nacos/v1/ns/instance/list":
+			q := r.URL.Query()
+			if q.Get("serviceName") != "auth" || q.Get("groupName") != "DEFAULT_GROUP" || q.Get("accessToken") != "token-1" {
+				t.Errorf("unexpected query: %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"hosts":[
+				{"ip":"10.0.0.1","port":8082,"weight":1.0,"healthy":true,"enabled":true},
+				{"ip":"10.0.0.2","port":8082,"weight":0.4,"healthy":true,"enabled":true},
+				{"ip":"10.0.0.3","port":8082,"weight":1.0,"healthy":false,"enabled":true}]}`)
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer nacos.Close()
+
+	src, err := NewNacosSource(&NacosSourceSpec{Address: nacos.URL, Service: "auth", Group: "DEFAULT_GROUP", Username: "nacos", Password: "nacos"})
+	if err != nil {
+		t.Fatalf("NewNacosSource error: %v", err)
+	}
+	nodes, err := src.Nodes(context.Background())
+	if err != nil {
+		t.Fatalf("Nodes error: %v", err)
+	}
+	if len(nodes) != 2 || nodes["10.0.0.1:8082"] != 1 || nodes["10.0.0.2:8082"] != 1 {
+		t.Errorf("unexpected nodes: %v", nodes)
+	}
+}
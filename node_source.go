@@ -0,0 +1,84 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+)
+
+// NodeSource 上游节点来源，由 agent 查询并同步到 APISIX upstream 的 nodes
+type NodeSource interface {
+	// Nodes 返回当前节点快照，用于首次注册 upstream
+	Nodes(ctx context.Context) (map[string]int, error)
+	// Watch 持续监听节点变化，每次变化回调 update，直到 ctx 取消
+	Watch(ctx context.Context, update func(nodes map[string]int)) error
+}
+
+// NewNodeSource 根据配置创建节点来源
+func NewNodeSource(spec *NodeSourceSpec) (NodeSource, error) {
+	switch spec.Type {
+	case "kubernetes":
+		if spec.Kubernetes == nil {
+			return nil, fmt.Errorf("node source kubernetes: missing kubernetes config")
+		}
+		return NewKubernetesSource(spec.Kubernetes)
+	case "consul":
+		if spec.Consul == nil {
+			return nil, fmt.Errorf("node source consul: missing consul config")
+		}
+		return NewConsulSource(spec.Consul)
+	case "nacos":
+		if spec.Nacos == nil {
+			return nil, fmt.Errorf("node source nacos: missing nacos config")
+		}
+		return NewNacosSource(spec.Nacos)
+	case "file":
+		if spec.File == nil {
+			return nil, fmt.Errorf("node source file: missing file config")
+		}
+		return NewFileSource(spec.File)
+	default:
+		return nil, fmt.Errorf("unsupported node source type: %s", spec.Type)
+	}
+}
+
+// openNodeSource 创建节点来源并查询首个节点集合。配置了节点来源时不能回退到占位节点，
+// 否则网关流量会被转发到网关自身的回环地址，因此创建或查询失败、节点为空都返回错误
+func openNodeSource(ctx context.Context, spec *NodeSourceSpec) (NodeSource, map[string]int, error) {
+	src, err := NewNodeSource(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := src.Nodes(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("node source %s: initial query: %w", spec.Type, err)
+	}
+	if len(nodes) == 0 {
+		return nil, nil, fmt.Errorf("node source %s: no nodes available", spec.Type)
+	}
+	return src, nodes, nil
+}
+
+// SyncUpstreamNodes 将节点来源的变化持续写入 upstream，直到 ctx 取消
+func SyncUpstreamNodes(ctx context.Context, client *ApisixClient, upstream *Upstream, src NodeSource) error {
+	last := upstream.Nodes
+	return src.Watch(ctx, func(nodes map[string]int) {
+		if reflect.DeepEqual(nodes, last) {
+			return
+		}
+		// APISIX upstream 必须包含 nodes，空节点时保留上一次的结果
+		if len(nodes) == 0 {
+			log.Printf("[APISIX-AGENT][Warn] Node source for upstream %s returned no nodes, keep previous nodes", upstream.ID)
+			return
+		}
+		up := *upstream
+		up.Nodes = nodes
+		if err := client.RegisterUpstream(ctx, &up); err != nil {
+			log.Printf("[APISIX-AGENT] Sync upstream nodes failed: %v", resourceError("upstream", upstream.ID, err))
+			return
+		}
+		last = nodes
+		log.Printf("[APISIX-AGENT] Upstream %s nodes synced: %v", upstream.ID, nodes)
+	})
+}
@@ -0,0 +1,206 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// MetadataConflict 网关中已有的插件元数据与本服务配置不一致
+type MetadataConflict struct {
+	Plugin string
+	Fields []string // 不一致的字段路径
+}
+
+func (c *MetadataConflict) Error() string {
+	return fmt.Sprintf("plugin metadata %s differs from gateway: %s", c.Plugin, strings.Join(c.Fields, ", "))
+}
+
+// normalizeJSON 转为 JSON 解码后的通用类型，便于与 Admin API 返回值比较
+func normalizeJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
+
+// diffSubset 返回 want 中与 got 不一致的字段路径；got 中多出的字段（如 APISIX 填充的默认值）不视为差异
+func diffSubset(want, got interface{}, path string) []string {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return []string{pathOrRoot(path)}
+		}
+		keys := make([]string, 0, len(w))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var diffs []string
+		for _, k := range keys {
+			diffs = append(diffs, diffSubset(w[k], g[k], joinPath(path, k))...)
+		}
+		return diffs
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return []string{pathOrRoot(path)}
+		}
+		var diffs []string
+		for i := range w {
+			diffs = append(diffs, diffSubset(w[i], g[i], fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return diffs
+	default:
+		if !reflect.DeepEqual(want, got) {
+			return []string{pathOrRoot(path)}
+		}
+		return nil
+	}
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
+
+// plugin_metadata 不支持 labels，归属记录在写入方 service 的 labels 中：
+// plugin-metadata.{name} 为本服务最后一次写入后网关中值的指纹。
+// 网关中的值与指纹一致说明之后没有其他服务修改过，本服务修改自己的配置时直接覆盖而不报告冲突
+const metadataLabelPrefix = "plugin-metadata."
+
+// metadataFingerprint 返回插件元数据的指纹，json.Marshal 对 map 按 key 排序，结果稳定
+func metadataFingerprint(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// metadataMarkers 从 service labels 中取出插件元数据的归属指纹
+func metadataMarkers(svc *Service) map[string]string {
+	markers := map[string]string{}
+	if svc == nil {
+		return markers
+	}
+	for k, v := range svc.Labels {
+		if name := strings.TrimPrefix(k, metadataLabelPrefix); name != k {
+			markers[name] = v
+		}
+	}
+	return markers
+}
+
+// ApplyPluginMetadata 幂等写入插件元数据：网关中不存在时写入，已一致时跳过；
+// 与网关中的值不一致（通常由其他服务设置）时返回 *MetadataConflict，spec.Override 为 true 时仍覆盖
+func ApplyPluginMetadata(ctx context.Context, client *ApisixClient, spec PluginMetadataSpec) (bool, error) {
+	written, _, err := applyPluginMetadata(ctx, client, spec, "")
+	return written, err
+}
+
+// applyPluginMetadata 同 ApplyPluginMetadata，last 为本服务上次写入的指纹，
+// 网关中的值仍是本服务写入的值时直接覆盖；返回写入后的指纹，值不归本服务所有时为空
+func applyPluginMetadata(ctx context.Context, client *ApisixClient, spec PluginMetadataSpec, last string) (bool, string, error) {
+	current, err := client.GetPluginMetadata(ctx, spec.Name)
+	if err != nil && !IsNotFound(err) {
+		return false, "", err
+	}
+	if err == nil {
+		want, err := normalizeJSON(spec.Config)
+		if err != nil {
+			return false, "", err
+		}
+		owned := last != "" && metadataFingerprint(current) == last
+		diffs := diffSubset(want, map[string]interface{}(current), "")
+		if len(diffs) == 0 {
+			if owned {
+				return false, last, nil
+			}
+			return false, "", nil
+		}
+		switch {
+		case owned:
+			log.Printf("[APISIX-AGENT] Updating plugin metadata %s (fields: %s)", spec.Name, strings.Join(diffs, ", "))
+		case spec.Override:
+			log.Printf("[APISIX-AGENT][Warn] Overriding plugin metadata %s (fields: %s)", spec.Name, strings.Join(diffs, ", "))
+		default:
+			return false, "", &MetadataConflict{Plugin: spec.Name, Fields: diffs}
+		}
+	}
+	if err := client.RegisterPluginMetadata(ctx, spec.Name, spec.Config); err != nil {
+		return false, "", err
+	}
+	// 指纹取网关中保存的值，包含 APISIX 补全的默认字段
+	stored, err := client.GetPluginMetadata(ctx, spec.Name)
+	if err != nil {
+		log.Printf("[APISIX-AGENT][Warn] GetPluginMetadata %s after write: %v", spec.Name, err)
+		return true, "", nil
+	}
+	return true, metadataFingerprint(stored), nil
+}
+
+// RegisterPluginMetadata 依次应用配置中的插件元数据，冲突只记录不中断；
+// markers 为本服务上次写入的指纹，返回本次写入后的指纹，未能写入的插件保留原指纹
+func RegisterPluginMetadata(ctx context.Context, client *ApisixClient, validator *SchemaValidator, specs []PluginMetadataSpec, markers map[string]string) map[string]string {
+	next := map[string]string{}
+	for i, spec := range specs {
+		if !validatePluginMetadata(ctx, validator, i, spec) {
+			if markers[spec.Name] != "" {
+				next[spec.Name] = markers[spec.Name]
+			}
+			continue
+		}
+		written, fp, err := applyPluginMetadata(ctx, client, spec, markers[spec.Name])
+		switch {
+		case err != nil:
+			log.Printf("[APISIX-AGENT] ERROR: %v", resourceError("plugin_metadata", spec.Name, err))
+			if _, conflict := err.(*MetadataConflict); !conflict && markers[spec.Name] != "" {
+				fp = markers[spec.Name]
+			}
+		case written:
+			log.Printf("[APISIX-AGENT] Plugin metadata registered: %s", spec.Name)
+		default:
+			log.Printf("[APISIX-AGENT] Plugin metadata %s already up to date", spec.Name)
+		}
+		if fp != "" {
+			next[spec.Name] = fp
+		}
+	}
+	return next
+}
+
+// validatePluginMetadata 插件元数据使用 /schema/plugins/{name}?schema_type=metadata 校验
+func validatePluginMetadata(ctx context.Context, v *SchemaValidator, i int, spec PluginMetadataSpec) bool {
+	if v == nil {
+		return true
+	}
+	schema, err := v.schema(ctx, "plugins/"+spec.Name+"?schema_type=metadata")
+	if err != nil {
+		log.Printf("[APISIX-AGENT][Warn] Schema validation skipped for plugin_metadata %s: %v", spec.Name, err)
+		return true
+	}
+	doc, err := normalizeJSON(spec.Config)
+	if err != nil {
+		return false
+	}
+	violations := validateSchema(schema, doc, "")
+	for _, e := range violations {
+		err := &SchemaError{Kind: "plugin_metadata", ID: spec.Name, Origin: fmt.Sprintf("plugin_metadata[%d]", i), Path: e.path, Message: e.message}
+		log.Printf("[APISIX-AGENT] ERROR: schema validation failed: %v", err)
+	}
+	return len(violations) == 0
+}
@@ -0,0 +1,115 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyPluginMetadata(t *testing.T) {
+	stored := map[string]map[string]interface{}{}
+	puts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path[len("/plugin_metadata/"):]
+		switch r.Method {
+		case "GET":
+			value, ok := stored[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"message":"Key not found"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"key": "/apisix/plugin_metadata/" + name, "value": value})
+		case "PUT":
+			puts++
+			var value map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&value)
+			// APISIX 会补全默认值与 id
+			value["id"] = name
+			value["include_req_body"] = false
+			stored[name] = value
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+	client := NewApisixClient(&Config{AdminAPI: srv.URL})
+	ctx := context.Background()
+	spec := PluginMetadataSpec{Name: "http-logger", Config: map[string]interface{}{
+		"log_format": map[string]interface{}{"host": "$host", "@timestamp": "$time_iso8601"},
+	}}
+
+	if written, err := ApplyPluginMetadata(ctx, client, spec); err != nil || !written {
+		t.Fatalf("expected first apply to write, written=%v err=%v", written, err)
+	}
+	// 已一致（网关补全的默认字段不算差异）
+	if written, err := ApplyPluginMetadata(ctx, client, spec); err != nil || written || puts != 1 {
+		t.Fatalf("expected idempotent apply, written=%v puts=%d err=%v", written, puts, err)
+	}
+
+	// 其他服务设置了不同的值
+	other := PluginMetadataSpec{Name: "http-logger", Config: map[string]interface{}{
+		"log_format": map[string]interface{}{"host": "$server_name"},
+	}}
+	_, err := ApplyPluginMetadata(ctx, client, other)
+	var conflict *MetadataConflict
+	if !errors.As(err, &conflict) || len(conflict.Fields) != 1 || conflict.Fields[0] != "log_format.host" || puts != 1 {
+		t.Fatalf("expected conflict on log_format.host without write, got %v puts=%d", err, puts)
+	}
+	other.Override = true
+	if written, err := ApplyPluginMetadata(ctx, client, other); err != nil || !written || puts != 2 {
+		t.Errorf("expected override to write, written=%v puts=%d err=%v", written, puts, err)
+	}
+}
+
+func TestRegisterPluginMetadata_Owner(t *testing.T) {
+	cfg := &Config{Backend: "standalone", Standalone: &StandaloneSpec{Path: filepath.Join(t.TempDir(), "apisix.yaml")}}
+	client := NewApisixClient(cfg)
+	ctx := context.Background()
+	spec := func(host string) []PluginMetadataSpec {
+		return []PluginMetadataSpec{{Name: "http-logger", Config: map[string]interface{}{
+			"log_format": map[string]interface{}{"host": host},
+		}}}
+	}
+
+	markers := RegisterPluginMetadata(ctx, client, nil, spec("$host"), nil)
+	if markers["http-logger"] == "" {
+		t.Fatalf("expected owner fingerprint after first write, got %v", markers)
+	}
+	// 通过 service labels 保存并读回指纹
+	svc := NewService("auth", "auth", "auth")
+	svc.Labels = map[string]string{metadataLabelPrefix + "http-logger": markers["http-logger"], "team": "core"}
+	if got := metadataMarkers(svc); len(got) != 1 || got["http-logger"] != markers["http-logger"] {
+		t.Fatalf("expected marker read back from labels, got %v", got)
+	}
+
+	// 本服务修改自己的配置：不报告冲突，直接更新
+	markers = RegisterPluginMetadata(ctx, client, nil, spec("$server_name"), markers)
+	current, err := client.GetPluginMetadata(ctx, "http-logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host := current["log_format"].(map[string]interface{})["host"]; host != "$server_name" || markers["http-logger"] == "" {
+		t.Fatalf("expected own metadata updated, got host=%v markers=%v", host, markers)
+	}
+
+	// 其他服务修改后，本服务不再拥有该值，变更报告冲突且不覆盖
+	if err := client.RegisterPluginMetadata(ctx, "http-logger", spec("$remote_addr")[0].Config); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = applyPluginMetadata(ctx, client, spec("$host")[0], markers["http-logger"])
+	var conflict *MetadataConflict
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected conflict after another service changed the metadata, got %v", err)
+	}
+	if markers = RegisterPluginMetadata(ctx, client, nil, spec("$host"), markers); len(markers) != 0 {
+		t.Errorf("expected ownership dropped on conflict, got %v", markers)
+	}
+	current, _ = client.GetPluginMetadata(ctx, "http-logger")
+	if host := current["log_format"].(map[string]interface{})["host"]; host != "$remote_addr" {
+		t.Errorf("expected other service's metadata kept, got %v", host)
+	}
+}
@@ -0,0 +1,81 @@
+package apisixregistryagent
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy Admin API 请求的统一重试策略：指数退避 + 抖动，
+// 仅重试网络错误、408/429/5xx，并受总耗时预算限制
+type RetryPolicy struct {
+	MaxAttempts     int           // 最多请求次数（含首次）
+	InitialInterval time.Duration // 首次退避时间
+	MaxInterval     time.Duration // 单次退避上限
+	MaxElapsed      time.Duration // 总耗时预算，0 表示不限制（DefaultRetryPolicy 默认 2m）
+}
+
+// DefaultRetryPolicy 根据配置生成重试策略
+func DefaultRetryPolicy(cfg *Config) RetryPolicy {
+	p := RetryPolicy{
+		MaxAttempts:     cfg.MaxRetry,
+		InitialInterval: cfg.RetryInterval,
+		MaxInterval:     cfg.RetryMaxInterval,
+		MaxElapsed:      cfg.RetryMaxElapsed,
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialInterval <= 0 {
+		p.InitialInterval = time.Second
+	}
+	if p.MaxInterval <= 0 {
+		p.MaxInterval = 30 * time.Second
+	}
+	// 默认限制总耗时，避免 5xx/429 与 Retry-After 使注册无限期阻塞；配置为负数时不限制
+	if p.MaxElapsed == 0 {
+		p.MaxElapsed = 2 * time.Minute
+	} else if p.MaxElapsed < 0 {
+		p.MaxElapsed = 0
+	}
+	return p
+}
+
+// Backoff 返回第 attempt 次（从 0 开始）失败后的等待时间，取 [d/2, d] 之间的随机值
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := p.InitialInterval
+	for i := 0; i < attempt && d < p.MaxInterval; i++ {
+		d *= 2
+	}
+	if d > p.MaxInterval {
+		d = p.MaxInterval
+	}
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// retryableStatus 判断状态码是否值得重试；其余 4xx（如 schema 校验失败）重试也不会成功
+func retryableStatus(status int) bool {
+	return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
+
+// parseRetryAfter 解析 Retry-After（秒数或 HTTP 日期），无效时返回 0
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,207 @@
+package apisixregistryagent
+
+import (
+	"fmt"
+	"log"
+)
+
+// copyPluginConfig 复制插件配置，避免多个路由共享同一个 map
+func copyPluginConfig(config map[string]interface{}) map[string]interface{} {
+	pluginConfig := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		pluginConfig[k] = v
+	}
+	return pluginConfig
+}
+
+// pluginOrigins 记录插件配置来源，例如 grpc-transcode -> route_plugins[1]
+func pluginOrigins(plugins []PluginSpec, prefix string) map[string]string {
+	origins := make(map[string]string, len(plugins))
+	for k, p := range plugins {
+		origins[p.Name] = fmt.Sprintf("%s[%d]", prefix, k)
+	}
+	return origins
+}
+
+// mergeURIs 合并主 uri 与额外 uris，去重并保持顺序
+func mergeURIs(uri string, uris []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, u := range append([]string{uri}, uris...) {
+		if u != "" && !seen[u] {
+			seen[u] = true
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// defaultRouteTimeout APISIX 路由 timeout 各项的默认值（秒）
+const defaultRouteTimeout = 60
+
+// mergeTimeout 将部分设置的 timeout 合并到已有值（route_defaults）上，仍未设置的项取 APISIX 默认值；
+// APISIX 的路由 timeout schema 要求 connect/send/read 同时存在
+func mergeTimeout(base *Timeout, spec *TimeoutSpec) *Timeout {
+	t := &Timeout{Connect: defaultRouteTimeout, Send: defaultRouteTimeout, Read: defaultRouteTimeout}
+	if base != nil {
+		*t = *base
+	}
+	if spec.Connect > 0 {
+		t.Connect = spec.Connect
+	}
+	if spec.Send > 0 {
+		t.Send = spec.Send
+	}
+	if spec.Read > 0 {
+		t.Read = spec.Read
+	}
+	return t
+}
+
+// applyRouteMatch 将已设置的匹配选项写入路由，未设置的字段保持不变
+func applyRouteMatch(route *Route, spec *RouteMatchSpec) {
+	if spec == nil {
+		return
+	}
+	if len(spec.Hosts) > 0 {
+		route.Hosts = spec.Hosts
+	}
+	if len(spec.Vars) > 0 {
+		route.Vars = spec.Vars
+	}
+	if spec.Priority != 0 {
+		route.Priority = spec.Priority
+	}
+	if len(spec.RemoteAddrs) > 0 {
+		route.RemoteAddrs = spec.RemoteAddrs
+	}
+	if spec.FilterFunc != "" {
+		route.FilterFunc = spec.FilterFunc
+	}
+	if spec.Timeout != nil {
+		route.Timeout = mergeTimeout(route.Timeout, spec.Timeout)
+	}
+	if spec.EnableWebsocket != nil {
+		route.EnableWebsocket = *spec.EnableWebsocket
+	}
+	if spec.Status != nil {
+		status := *spec.Status
+		route.Status = &status
+	}
+}
+
+// buildCustomRoute 用自定义路由配置覆盖 proto 解析结果，并补全 grpc-transcode 必填字段
+func buildCustomRoute(cfg *Config, serviceID, id string, r map[string]interface{}, cr RouteConfig) *Route {
+	route := NewRoute(id, serviceID, cr.URI).WithMethods(cr.Methods...).WithPluginConfig(pluginConfigID(serviceID, cr.PluginConfig))
+	route.Desc = "Auto registered by apisix-registry-agent (custom config)"
+	if len(cr.URIs) > 0 {
+		route.URIs = mergeURIs(cr.URI, cr.URIs)
+		route.URI = ""
+	}
+	applyRouteMatch(route, cfg.RouteDefaults)
+	applyRouteMatch(route, &cr.RouteMatchSpec)
+	for _, p := range cr.Plugins {
+		pluginConfig := copyPluginConfig(p.Config)
+		// 自动补全 grpc-transcode method 字段
+		if p.Name == "grpc-transcode" {
+			if pluginConfig["method"] == nil {
+				if gm, ok := r["grpc_method"]; ok && gm != nil && gm != "" {
+					pluginConfig["method"] = gm
+					if cfg.Debug {
+						log.Printf("[APISIX-AGENT][DEBUG] auto fill grpc-transcode method: %v", gm)
+					}
+				} else {
+					log.Printf("[APISIX-AGENT] ERROR: grpc-transcode method missing for custom route %v, please set method field", cr.URI)
+				}
+			}
+			// 自动补全 proto_id 字段
+			if pluginConfig["proto_id"] == nil && cfg.ProtoPath != "" {
+				pluginConfig["proto_id"] = serviceID
+				if cfg.Debug {
+					log.Printf("[APISIX-AGENT][DEBUG] auto fill grpc-transcode proto_id: %v", serviceID)
+				}
+			}
+			// 自动补全 service 字段
+			if pluginConfig["service"] == nil && cfg.ServiceName != "" {
+				pluginConfig["service"] = "micro." + capitalize(cfg.ServiceName) + "Service"
+				if cfg.Debug {
+					log.Printf("[APISIX-AGENT][DEBUG] auto fill grpc-transcode service: %v", pluginConfig["service"])
+				}
+			}
+			// 强校验必填字段
+			for _, key := range []string{"method", "proto_id", "service"} {
+				if pluginConfig[key] == nil || pluginConfig[key] == "" {
+					log.Printf("[APISIX-AGENT] ERROR: grpc-transcode %s missing for custom route %v, please set %s field", key, cr.URI, key)
+				}
+			}
+		}
+		route.WithPlugin(p.Name, pluginConfig)
+	}
+	return route
+}
+
+// buildProtoRoute 根据 proto 解析结果与 route_plugins 模板生成路由
+func buildProtoRoute(cfg *Config, serviceID, id string, r map[string]interface{}) *Route {
+	uri, _ := r["uri"].(string)
+	route := NewRoute(id, serviceID, uri).WithPluginConfig(pluginConfigID(serviceID, cfg.RoutePluginConfig))
+	route.Desc = "Auto registered by apisix-registry-agent"
+	applyRouteMatch(route, cfg.RouteDefaults)
+	if ms, ok := r["methods"].([]string); ok {
+		route.WithMethods(ms...)
+	}
+	for _, p := range cfg.RoutePlugins {
+		pluginConfig := copyPluginConfig(p.Config)
+		if p.Name == "grpc-transcode" {
+			gm, ok := r["grpc_method"]
+			if !ok || gm == nil || gm == "" {
+				log.Printf("[APISIX-AGENT] ERROR: grpc_method not found for route %v, skip grpc-transcode method", r)
+				continue
+			}
+			pluginConfig["method"] = gm
+			if cfg.Debug {
+				log.Printf("[APISIX-AGENT][DEBUG] grpc-transcode method set: %v", gm)
+			}
+		}
+		route.WithPlugin(p.Name, pluginConfig)
+	}
+	return route
+}
+
+// pluginConfigID 返回 owner 的插件组 ID：{owner}.{id}。plugin_config 为全局资源，
+// 加上 service_id 前缀后不同服务使用相同的 id 也不会互相覆盖或在退出时删除对方的插件组
+func pluginConfigID(owner, id string) string {
+	if id == "" {
+		return ""
+	}
+	return owner + "." + id
+}
+
+// buildPluginConfig 根据 plugin_configs 配置生成 /plugin_configs 资源
+func buildPluginConfig(owner string, spec PluginConfigSpec) *PluginConfig {
+	pc := &PluginConfig{ID: pluginConfigID(owner, spec.ID), Desc: spec.Desc, Plugins: map[string]interface{}{}}
+	if pc.Desc == "" {
+		pc.Desc = "Auto registered by apisix-registry-agent"
+	}
+	for _, p := range spec.Plugins {
+		pc.Plugins[p.Name] = copyPluginConfig(p.Config)
+	}
+	return pc
+}
+
+// buildService 生成 service，附加 service 配置中的插件、hosts 等属性
+func buildService(cfg *Config, serviceID, upstreamID string) *Service {
+	svc := NewService(serviceID, cfg.ServiceName, upstreamID)
+	svc.Desc = "Auto registered by apisix-registry-agent"
+	if spec := cfg.Service; spec != nil {
+		if spec.Desc != "" {
+			svc.Desc = spec.Desc
+		}
+		svc.Hosts = spec.Hosts
+		svc.EnableWebsocket = spec.EnableWebsocket
+		svc.Labels = spec.Labels
+		for _, p := range spec.Plugins {
+			svc.WithPlugin(p.Name, copyPluginConfig(p.Config))
+		}
+	}
+	return svc
+}
@@ -0,0 +1,409 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// SchemaError 本地 schema 校验失败的详细信息
+type SchemaError struct {
+	Kind    string // route/service/upstream
+	ID      string
+	Origin  string // 产生该配置的配置文件路径，例如 route_plugins[1]
+	Path    string // payload 中的字段路径，例如 plugins.grpc-transcode.method
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	msg := fmt.Sprintf("%s %s: %s: %s", e.Kind, e.ID, e.Path, e.Message)
+	if e.Origin != "" {
+		msg += fmt.Sprintf(" (from %s)", e.Origin)
+	}
+	return msg
+}
+
+// SchemaValidator 通过 Admin API 的 /schema 接口获取资源与插件的 JSON schema（带缓存），
+// 在写入前本地校验生成的 payload
+type SchemaValidator struct {
+	client *ApisixClient
+
+	mu    sync.Mutex
+	cache map[string]map[string]interface{}
+}
+
+func NewSchemaValidator(client *ApisixClient) *SchemaValidator {
+	return &SchemaValidator{client: client, cache: map[string]map[string]interface{}{}}
+}
+
+// schema 获取并缓存 /schema/{name}，例如 route、plugins/grpc-transcode
+func (v *SchemaValidator) schema(ctx context.Context, name string) (map[string]interface{}, error) {
+	v.mu.Lock()
+	s, ok := v.cache[name]
+	v.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+	body, err := v.client.doRequest(ctx, "GET", "/schema/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &s); err != nil {
+		return nil, fmt.Errorf("decode schema %s: %w", name, err)
+	}
+	v.mu.Lock()
+	v.cache[name] = s
+	v.mu.Unlock()
+	return s, nil
+}
+
+// pluginSchemaName 插件 schema 路径；四层插件（如 mqtt-proxy）只在 stream 子系统中存在，
+// 缓存按完整路径区分子系统
+func pluginSchemaName(kind, plugin string) string {
+	if kind == "stream_route" {
+		return "plugins/" + plugin + "?subsystem=stream"
+	}
+	return "plugins/" + plugin
+}
+
+// Validate 校验资源 payload 及其中每个插件配置；origins 为插件名到配置来源的映射，用于错误提示。
+// 获取 schema 失败时返回 error（调用方可选择跳过校验），校验失败时返回全部 SchemaError
+func (v *SchemaValidator) Validate(ctx context.Context, kind, id string, payload interface{}, origins map[string]string) ([]*SchemaError, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var errs []*SchemaError
+	resourceSchema, err := v.schema(ctx, kind)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s schema: %w", kind, err)
+	}
+	for _, e := range validateSchema(resourceSchema, doc, "") {
+		errs = append(errs, &SchemaError{Kind: kind, ID: id, Path: e.path, Message: e.message})
+	}
+	plugins, _ := doc["plugins"].(map[string]interface{})
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pluginSchema, err := v.schema(ctx, pluginSchemaName(kind, name))
+		if err != nil {
+			if IsNotFound(err) {
+				errs = append(errs, &SchemaError{Kind: kind, ID: id, Origin: origins[name], Path: "plugins." + name, Message: "unknown plugin"})
+				continue
+			}
+			return nil, fmt.Errorf("fetch plugin %s schema: %w", name, err)
+		}
+		for _, e := range validateSchema(pluginSchema, plugins[name], "plugins."+name) {
+			errs = append(errs, &SchemaError{Kind: kind, ID: id, Origin: origins[name], Path: e.path, Message: e.message})
+		}
+	}
+	return errs, nil
+}
+
+// validatePayload Run 中写入前的校验，返回 false 表示 payload 不合法，应跳过写入
+func validatePayload(ctx context.Context, v *SchemaValidator, kind, id string, payload interface{}, origins map[string]string) bool {
+	if v == nil {
+		return true
+	}
+	errs, err := v.Validate(ctx, kind, id, payload, origins)
+	if err != nil {
+		log.Printf("[APISIX-AGENT][Warn] Schema validation skipped for %s %s: %v", kind, id, err)
+		return true
+	}
+	for _, e := range errs {
+		log.Printf("[APISIX-AGENT] ERROR: schema validation failed: %v", e)
+	}
+	return len(errs) == 0
+}
+
+type schemaViolation struct {
+	path    string
+	message string
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// validateSchema 校验 JSON schema 的常用子集（APISIX 插件与资源 schema 使用的关键字），
+// 未识别的关键字忽略，避免误报
+func validateSchema(schema map[string]interface{}, value interface{}, path string) []schemaViolation {
+	var out []schemaViolation
+	fail := func(format string, args ...interface{}) {
+		p := path
+		if p == "" {
+			p = "(root)"
+		}
+		out = append(out, schemaViolation{path: p, message: fmt.Sprintf(format, args...)})
+	}
+
+	if t, ok := schema["type"]; ok && !matchType(t, value) {
+		fail("expected %v, got %s", t, jsonTypeName(value))
+		return out
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value %v not in enum %v", value, enum)
+		}
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, value) {
+		fail("value %v must be %v", value, c)
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, exists := val[name]; !exists {
+						out = append(out, schemaViolation{path: joinPath(path, name), message: "property is required"})
+					}
+				}
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		patterns, _ := schema["patternProperties"].(map[string]interface{})
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := props[k].(map[string]interface{}); ok {
+				out = append(out, validateSchema(ps, val[k], joinPath(path, k))...)
+				continue
+			}
+			// patternProperties 命中的属性不属于 additionalProperties
+			matched := false
+			for p, s := range patterns {
+				re, err := regexp.Compile(p)
+				if err != nil {
+					// 无法用 RE2 编译的模式视为命中，不做校验，避免误报
+					matched = true
+					continue
+				}
+				if !re.MatchString(k) {
+					continue
+				}
+				matched = true
+				if ps, ok := s.(map[string]interface{}); ok {
+					out = append(out, validateSchema(ps, val[k], joinPath(path, k))...)
+				}
+			}
+			if matched {
+				continue
+			}
+			switch ap := schema["additionalProperties"].(type) {
+			case bool:
+				if !ap {
+					out = append(out, schemaViolation{path: joinPath(path, k), message: "additional property not allowed"})
+				}
+			case map[string]interface{}:
+				out = append(out, validateSchema(ap, val[k], joinPath(path, k))...)
+			}
+		}
+		// dependencies：属性存在时要求其他属性同时存在（数组形式）或整个对象满足 schema
+		if deps, ok := schema["dependencies"].(map[string]interface{}); ok {
+			for _, k := range keys {
+				switch dep := deps[k].(type) {
+				case []interface{}:
+					for _, r := range dep {
+						if name, ok := r.(string); ok {
+							if _, exists := val[name]; !exists {
+								out = append(out, schemaViolation{path: joinPath(path, name), message: fmt.Sprintf("property is required by %s", k)})
+							}
+						}
+					}
+				case map[string]interface{}:
+					out = append(out, validateSchema(dep, value, path)...)
+				}
+			}
+		}
+		if n, ok := number(schema["minProperties"]); ok && float64(len(val)) < n {
+			fail("expected at least %v properties", n)
+		}
+		if n, ok := number(schema["maxProperties"]); ok && float64(len(val)) > n {
+			fail("expected at most %v properties", n)
+		}
+	case []interface{}:
+		if n, ok := number(schema["minItems"]); ok && float64(len(val)) < n {
+			fail("expected at least %v items", n)
+		}
+		if n, ok := number(schema["maxItems"]); ok && float64(len(val)) > n {
+			fail("expected at most %v items", n)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range val {
+				out = append(out, validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(val))
+		if n, ok := number(schema["minLength"]); ok && length < n {
+			fail("string shorter than %v", n)
+		}
+		if n, ok := number(schema["maxLength"]); ok && length > n {
+			fail("string longer than %v", n)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			// 无法用 RE2 编译的 PCRE 表达式跳过
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(val) {
+				fail("string %q does not match pattern %q", val, p)
+			}
+		}
+	case float64:
+		if n, ok := number(schema["minimum"]); ok {
+			if excl, _ := schema["exclusiveMinimum"].(bool); (excl && val <= n) || val < n {
+				fail("value %v below minimum %v", val, n)
+			}
+		}
+		if n, ok := number(schema["maximum"]); ok {
+			if excl, _ := schema["exclusiveMaximum"].(bool); (excl && val >= n) || val > n {
+				fail("value %v above maximum %v", val, n)
+			}
+		}
+		if n, ok := number(schema["exclusiveMinimum"]); ok && val <= n {
+			fail("value %v must be greater than %v", val, n)
+		}
+		if n, ok := number(schema["exclusiveMaximum"]); ok && val >= n {
+			fail("value %v must be less than %v", val, n)
+		}
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range all {
+			if sub, ok := s.(map[string]interface{}); ok {
+				out = append(out, validateSchema(sub, value, path)...)
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && countMatches(anyOf, value, path) == 0 {
+		fail("value does not match any of the allowed schemas (anyOf)")
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		if n := countMatches(oneOf, value, path); n != 1 {
+			fail("value must match exactly one schema (oneOf), matched %d", n)
+		}
+	}
+	if not, ok := schema["not"].(map[string]interface{}); ok && len(validateSchema(not, value, path)) == 0 {
+		fail("value must not match schema (not)")
+	}
+	if cond, ok := schema["if"].(map[string]interface{}); ok {
+		branch := "else"
+		if len(validateSchema(cond, value, path)) == 0 {
+			branch = "then"
+		}
+		if sub, ok := schema[branch].(map[string]interface{}); ok {
+			out = append(out, validateSchema(sub, value, path)...)
+		}
+	}
+	return out
+}
+
+func countMatches(schemas []interface{}, value interface{}, path string) int {
+	n := 0
+	for _, s := range schemas {
+		if sub, ok := s.(map[string]interface{}); ok && len(validateSchema(sub, value, path)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func number(v interface{}) (float64, bool) {
+	n, ok := v.(float64)
+	return n, ok
+}
+
+func matchType(t interface{}, value interface{}) bool {
+	switch tt := t.(type) {
+	case string:
+		return matchSingleType(tt, value)
+	case []interface{}:
+		for _, x := range tt {
+			if s, ok := x.(string); ok && matchSingleType(s, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchSingleType(t string, value interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		if !ok {
+			// Lua 中空数组与空对象无法区分，APISIX 允许 {} 作为空数组
+			if m, isMap := value.(map[string]interface{}); isMap && len(m) == 0 {
+				return true
+			}
+		}
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+func jsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case nil:
+		return "null"
+	}
+	return strings.ToLower(reflect.TypeOf(value).Kind().String())
+}
@@ -0,0 +1,154 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSchemaValidator_Validate(t *testing.T) {
+	var fetches int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		switch r.URL.Path {
+		case "/schema/route":
+			fmt.Fprint(w, `{"type":"object","properties":{"uri":{"type":"string","minLength":1},"plugins":{"type":"object"}},
+				"anyOf":[{"required":["uri"]},{"required":["uris"]}]}`)
+		case "/schema/plugins/grpc-transcode":
+			fmt.Fprint(w, `{"type":"object","required":["proto_id","service","method"],
+				"properties":{"proto_id":{"type":["string","integer"]},"deadline":{"type":"number","minimum":0},
+				"pb_option":{"type":"array","items":{"type":"string","enum":["enum_as_name","enum_as_value"]}}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, MaxRetry: 1, RetryInterval: time.Millisecond})
+	v := NewSchemaValidator(client)
+
+	route := NewRoute("auth-3", "auth", "/v1/login").
+		WithPlugin("grpc-transcode", map[string]interface{}{"proto_id": "auth", "service": "micro.AuthService", "deadline": -1, "pb_option": []string{"bad"}}).
+		WithPlugin("no-such-plugin", map[string]interface{}{})
+	origins := map[string]string{"grpc-transcode": "route_plugins[1]", "no-such-plugin": "route_plugins[2]"}
+	errs, err := v.Validate(context.Background(), "route", route.ID, route, origins)
+	if err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+	want := map[string]bool{
+		"route auth-3: plugins.grpc-transcode.method: property is required (from route_plugins[1])":                                     true,
+		"route auth-3: plugins.grpc-transcode.deadline: value -1 below minimum 0 (from route_plugins[1])":                               true,
+		`route auth-3: plugins.grpc-transcode.pb_option[0]: value bad not in enum [enum_as_name enum_as_value] (from route_plugins[1])`: true,
+		"route auth-3: plugins.no-such-plugin: unknown plugin (from route_plugins[2])":                                                  true,
+	}
+	if len(errs) != len(want) {
+		t.Errorf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for _, e := range errs {
+		if !want[e.Error()] {
+			t.Errorf("unexpected error: %s", e.Error())
+		}
+	}
+
+	// schema 缓存：再次校验不重新请求
+	before := fetches
+	route.Plugins = map[string]interface{}{"grpc-transcode": map[string]interface{}{"proto_id": 1, "service": "s", "method": "m"}}
+	if errs, _ := v.Validate(context.Background(), "route", route.ID, route, nil); len(errs) != 0 {
+		t.Errorf("expected valid route, got %v", errs)
+	}
+	if fetches != before {
+		t.Errorf("expected cached schemas, got %d new fetches", fetches-before)
+	}
+}
+
+func TestValidateSchema_Combinators(t *testing.T) {
+	schema := map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"required": []interface{}{"a"}},
+			map[string]interface{}{"required": []interface{}{"b"}},
+		},
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"a": map[string]interface{}{"type": "integer"},
+			"b": map[string]interface{}{"type": "string", "pattern": "^v[0-9]+$"},
+		},
+	}
+	if errs := validateSchema(schema, map[string]interface{}{"a": 1.0}, ""); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if errs := validateSchema(schema, map[string]interface{}{"a": 1.5, "b": "x", "c": true}, ""); len(errs) != 4 {
+		t.Errorf("expected 4 errors (type, pattern, additional, oneOf), got %v", errs)
+	}
+}
+
+func TestValidateSchema_PatternPropertiesAndDependencies(t *testing.T) {
+	schema := map[string]interface{}{
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"count": map[string]interface{}{"type": "integer"},
+			"policy": map[string]interface{}{"type": "string"},
+			"redis_host": map[string]interface{}{"type": "string"},
+		},
+		"patternProperties": map[string]interface{}{
+			"^x-": map[string]interface{}{"type": "string"},
+			"(?<=a)b": map[string]interface{}{"type": "string"},
+		},
+		"dependencies": map[string]interface{}{
+			"count": []interface{}{"policy"},
+			"policy": map[string]interface{}{
+				"if":   map[string]interface{}{"properties": map[string]interface{}{"policy": map[string]interface{}{"const": "redis"}}},
+				"then": map[string]interface{}{"required": []interface{}{"redis_host"}},
+			},
+		},
+	}
+	ok := map[string]interface{}{"count": 1.0, "policy": "local", "x-trace": "on"}
+	if errs := validateSchema(schema, ok, ""); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	// 含 RE2 不支持的模式时，未匹配其他规则的属性不按 additionalProperties 报错
+	bad := map[string]interface{}{"count": 1.0, "x-trace": 1.0, "other": true}
+	if errs := validateSchema(schema, bad, ""); len(errs) != 2 {
+		t.Errorf("expected 2 errors (pattern type, dependency), got %v", errs)
+	}
+	redis := map[string]interface{}{"policy": "redis"}
+	if errs := validateSchema(schema, redis, ""); len(errs) != 1 || errs[0].path != "redis_host" {
+		t.Errorf("expected redis_host required by if/then, got %v", errs)
+	}
+}
+
+func TestSchemaValidator_StreamSubsystem(t *testing.T) {
+	fetches := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches[r.URL.RequestURI()]++
+		switch r.URL.RequestURI() {
+		case "/schema/stream_route", "/schema/route":
+			fmt.Fprint(w, `{"type":"object"}`)
+		case "/schema/plugins/mqtt-proxy?subsystem=stream":
+			fmt.Fprint(w, `{"type":"object","required":["protocol_name"]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, MaxRetry: 1, RetryInterval: time.Millisecond})
+	v := NewSchemaValidator(client)
+	ctx := context.Background()
+
+	route := &StreamRoute{ID: "mqtt", ServerPort: 1883, UpstreamID: "auth",
+		Plugins: map[string]interface{}{"mqtt-proxy": map[string]interface{}{"protocol_name": "MQTT"}}}
+	for i := 0; i < 2; i++ {
+		if errs, err := v.Validate(ctx, "stream_route", route.ID, route, nil); err != nil || len(errs) != 0 {
+			t.Fatalf("expected stream plugin schema from stream subsystem, errs=%v err=%v", errs, err)
+		}
+	}
+	if fetches["/schema/plugins/mqtt-proxy?subsystem=stream"] != 1 {
+		t.Errorf("expected stream plugin schema fetched once, got %v", fetches)
+	}
+	// http 路由仍使用 http 子系统的 schema，缓存互不影响
+	httpRoute := NewRoute("r1", "auth", "/").WithPlugin("mqtt-proxy", map[string]interface{}{})
+	if errs, _ := v.Validate(ctx, "route", httpRoute.ID, httpRoute, nil); len(errs) != 1 || errs[0].Message != "unknown plugin" {
+		t.Errorf("expected mqtt-proxy unknown for http routes, got %v", errs)
+	}
+}
@@ -0,0 +1,184 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretProvider 密钥来源，例如 Admin API key
+type SecretProvider interface {
+	Secret(ctx context.Context) (string, error)
+}
+
+// EnvSecret 从环境变量读取
+type EnvSecret struct {
+	Name string
+}
+
+func (s *EnvSecret) Secret(ctx context.Context) (string, error) {
+	v := os.Getenv(s.Name)
+	if v == "" {
+		return "", fmt.Errorf("secret env %s is empty", s.Name)
+	}
+	return v, nil
+}
+
+// FileSecret 从文件读取（去掉首尾空白），适用于 Kubernetes/Docker secret 挂载
+type FileSecret struct {
+	Path string
+}
+
+func (s *FileSecret) Secret(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return "", fmt.Errorf("read secret file: %w", err)
+	}
+	v := strings.TrimSpace(string(data))
+	if v == "" {
+		return "", fmt.Errorf("secret file %s is empty", s.Path)
+	}
+	return v, nil
+}
+
+// VaultSecret 通过 HTTP 读取 Vault KV（v1/v2 均支持）中的字段
+type VaultSecret struct {
+	Address    string
+	Path       string // 例如 secret/data/apisix（KV v2）或 kv/apisix（KV v1）
+	Field      string
+	Token      string
+	TokenFile  string
+	Namespace  string
+	HTTPClient *http.Client
+}
+
+func (s *VaultSecret) token() (string, error) {
+	if s.TokenFile != "" {
+		data, err := os.ReadFile(s.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("read vault token: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if s.Token != "" {
+		return s.Token, nil
+	}
+	return os.Getenv("VAULT_TOKEN"), nil
+}
+
+func (s *VaultSecret) Secret(ctx context.Context) (string, error) {
+	token, err := s.token()
+	if err != nil {
+		return "", err
+	}
+	u := strings.TrimRight(s.Address, "/") + "/v1/" + strings.TrimLeft(s.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if s.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.Namespace)
+	}
+	hc := s.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault read %s: %w", s.Path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("vault read %s: status=%d", s.Path, resp.StatusCode)
+	}
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("vault read %s: %w", s.Path, err)
+	}
+	data := body.Data
+	// KV v2 的字段位于 data.data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasField := data[s.Field]; !hasField {
+			data = inner
+		}
+	}
+	v, ok := data[s.Field].(string)
+	if !ok || v == "" {
+		return "", fmt.Errorf("vault read %s: field %s not found", s.Path, s.Field)
+	}
+	return v, nil
+}
+
+// NewSecretProvider 根据配置创建密钥来源
+func NewSecretProvider(spec *SecretSourceSpec) (SecretProvider, error) {
+	switch spec.Type {
+	case "env":
+		if spec.Env == "" {
+			return nil, fmt.Errorf("secret source env: env is required")
+		}
+		return &EnvSecret{Name: spec.Env}, nil
+	case "file":
+		if spec.File == "" {
+			return nil, fmt.Errorf("secret source file: file is required")
+		}
+		return &FileSecret{Path: spec.File}, nil
+	case "vault":
+		if spec.Vault == nil || spec.Vault.Address == "" || spec.Vault.Path == "" || spec.Vault.Field == "" {
+			return nil, fmt.Errorf("secret source vault: address, path and field are required")
+		}
+		return &VaultSecret{
+			Address:   spec.Vault.Address,
+			Path:      spec.Vault.Path,
+			Field:     spec.Vault.Field,
+			Token:     spec.Vault.Token,
+			TokenFile: spec.Vault.TokenFile,
+			Namespace: spec.Vault.Namespace,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported secret source type: %s", spec.Type)
+	}
+}
+
+// cachedSecret 缓存密钥并按 interval 重新读取，用于密钥轮换
+type cachedSecret struct {
+	provider SecretProvider
+	interval time.Duration
+
+	mu        sync.Mutex
+	value     string
+	fetchedAt time.Time
+}
+
+func newCachedSecret(provider SecretProvider, interval time.Duration) *cachedSecret {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &cachedSecret{provider: provider, interval: interval}
+}
+
+// Secret 返回缓存的密钥；force 为 true 时立即重新读取（如收到 401）。
+// 读取失败时若有旧值则继续使用旧值
+func (c *cachedSecret) Secret(ctx context.Context, force bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !force && c.value != "" && time.Since(c.fetchedAt) < c.interval {
+		return c.value, nil
+	}
+	v, err := c.provider.Secret(ctx)
+	if err != nil {
+		if c.value != "" {
+			return c.value, err
+		}
+		return "", err
+	}
+	c.value, c.fetchedAt = v, time.Now()
+	return v, nil
+}
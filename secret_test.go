@@ -0,0 +1,106 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSecret_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin-key")
+	if err := os.WriteFile(path, []byte("key-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cache := newCachedSecret(&FileSecret{Path: path}, time.Hour)
+	ctx := context.Background()
+	if v, err := cache.Secret(ctx, false); err != nil || v != "key-1" {
+		t.Fatalf("expected key-1, got %q err=%v", v, err)
+	}
+	os.WriteFile(path, []byte("key-2"), 0600)
+	if v, _ := cache.Secret(ctx, false); v != "key-1" {
+		t.Errorf("expected cached key-1 before refresh, got %q", v)
+	}
+	if v, _ := cache.Secret(ctx, true); v != "key-2" {
+		t.Errorf("expected key-2 after forced refresh, got %q", v)
+	}
+	// 读取失败时沿用旧值
+	os.Remove(path)
+	if v, err := cache.Secret(ctx, true); err == nil || v != "key-2" {
+		t.Errorf("expected stale key-2 with error, got %q err=%v", v, err)
+	}
+}
+
+func TestVaultSecret_KV(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/apisix":
+			w.Write([]byte(`{"data":{"data":{"admin_key":"v2-key"},"metadata":{"version":3}}}`))
+		case "/v1/kv/apisix":
+			w.Write([]byte(`{"data":{"admin_key":"v1-key"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("vault-token\n"), 0600)
+	for path, want := range map[string]string{"secret/data/apisix": "v2-key", "kv/apisix": "v1-key"} {
+		p, err := NewSecretProvider(&SecretSourceSpec{Type: "vault", Vault: &VaultSecretSpec{
+			Address: srv.URL, Path: path, Field: "admin_key", TokenFile: tokenFile,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, err := p.Secret(context.Background()); err != nil || v != want {
+			t.Errorf("%s: expected %q, got %q err=%v", path, want, v, err)
+		}
+	}
+
+	bad := &VaultSecret{Address: srv.URL, Path: "secret/data/apisix", Field: "missing", Token: "vault-token"}
+	if _, err := bad.Secret(context.Background()); err == nil {
+		t.Error("expected error for missing field")
+	}
+}
+
+func TestApisixClient_AdminKeyRotationOn401(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin-key")
+	os.WriteFile(path, []byte("old"), 0600)
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("X-API-KEY"))
+		if r.Header.Get("X-API-KEY") != "new" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, AdminKeyFile: path, MaxRetry: 1, AdminKey: "static"})
+	ctx := context.Background()
+	if err := client.DeleteRoute(ctx, "r1"); err == nil {
+		t.Fatal("expected 401 with old key")
+	}
+	os.WriteFile(path, []byte("new"), 0600)
+	if err := client.DeleteRoute(ctx, "r1"); err != nil {
+		t.Fatalf("expected success after key rotation, got %v", err)
+	}
+	want := []string{"old", "old", "new"}
+	if len(keys) != len(want) {
+		t.Fatalf("expected keys %v, got %v", want, keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("request %d: expected key %q, got %q", i, want[i], keys[i])
+		}
+	}
+}
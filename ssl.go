@@ -0,0 +1,175 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// BuildSSL 读取证书文件生成 SSL 对象，同时校验证书与私钥匹配，返回证书过期时间
+func BuildSSL(id string, spec SSLSpec) (*SSL, time.Time, error) {
+	if spec.CertFile == "" || spec.KeyFile == "" {
+		return nil, time.Time{}, fmt.Errorf("ssl %s: cert_file and key_file are required", id)
+	}
+	certPEM, err := os.ReadFile(spec.CertFile)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("ssl %s: %w", id, err)
+	}
+	keyPEM, err := os.ReadFile(spec.KeyFile)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("ssl %s: %w", id, err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("ssl %s: %w", id, err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("ssl %s: %w", id, err)
+	}
+	ssl := &SSL{ID: id, Cert: string(certPEM), Key: string(keyPEM), SNIs: spec.SNIs}
+	if len(ssl.SNIs) == 0 {
+		ssl.SNIs = leaf.DNSNames
+	}
+	if len(ssl.SNIs) == 0 {
+		return nil, time.Time{}, fmt.Errorf("ssl %s: no snis configured and certificate has no DNS names", id)
+	}
+	if spec.ClientCAFile != "" {
+		ca, err := os.ReadFile(spec.ClientCAFile)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("ssl %s: client ca: %w", id, err)
+		}
+		ssl.Client = &SSLClient{CA: string(ca), Depth: spec.ClientDepth}
+	}
+	return ssl, leaf.NotAfter, nil
+}
+
+// sslID 返回 SSL 对象 ID
+func sslID(serviceID string, i int, spec SSLSpec) string {
+	if spec.ID != "" {
+		return spec.ID
+	}
+	return fmt.Sprintf("%s-ssl-%d", serviceID, i)
+}
+
+// sslFiles 返回 SSL 对象依赖的文件，用于检测变化
+func sslFiles(spec SSLSpec) []string {
+	files := []string{spec.CertFile, spec.KeyFile}
+	if spec.ClientCAFile != "" {
+		files = append(files, spec.ClientCAFile)
+	}
+	return files
+}
+
+// sslExpiryWarnEvery 同一证书的过期告警间隔，避免每次检查都输出
+const sslExpiryWarnEvery = 24 * time.Hour
+
+// warnExpiry 证书即将过期或已过期时告警，返回是否输出了告警
+func warnExpiry(id string, notAfter time.Time, warnBefore time.Duration) bool {
+	left := time.Until(notAfter)
+	switch {
+	case left <= 0:
+		log.Printf("[APISIX-AGENT] ERROR: SSL %s certificate expired at %s", id, notAfter.Format(time.RFC3339))
+	case left < warnBefore:
+		log.Printf("[APISIX-AGENT][Warn] SSL %s certificate expires in %s (%s)", id, left.Round(time.Hour), notAfter.Format(time.RFC3339))
+	default:
+		return false
+	}
+	return true
+}
+
+// SSLManager 注册配置中的 SSL 对象，证书文件变化时重新注册，并定期检查证书有效期
+type SSLManager struct {
+	client     *ApisixClient
+	specs      []SSLSpec
+	ids        []string
+	interval   time.Duration
+	warnBefore time.Duration
+
+	mods     []time.Time
+	notAfter []time.Time
+	warned   []time.Time
+}
+
+func NewSSLManager(client *ApisixClient, cfg *Config, serviceID string) *SSLManager {
+	m := &SSLManager{
+		client:     client,
+		specs:      cfg.SSLs,
+		interval:   cfg.SSLCheckInterval,
+		warnBefore: cfg.SSLExpiryWarning,
+		mods:       make([]time.Time, len(cfg.SSLs)),
+		notAfter:   make([]time.Time, len(cfg.SSLs)),
+		warned:     make([]time.Time, len(cfg.SSLs)),
+	}
+	if m.interval <= 0 {
+		m.interval = time.Minute
+	}
+	if m.warnBefore <= 0 {
+		m.warnBefore = 30 * 24 * time.Hour
+	}
+	for i, spec := range cfg.SSLs {
+		m.ids = append(m.ids, sslID(serviceID, i, spec))
+	}
+	return m
+}
+
+// Sync 注册文件有变化（或尚未注册成功）的 SSL 对象，并检查有效期
+func (m *SSLManager) Sync(ctx context.Context) {
+	for i, spec := range m.specs {
+		id := m.ids[i]
+		mod, err := modTime(sslFiles(spec)...)
+		if err != nil {
+			log.Printf("[APISIX-AGENT] ERROR: ssl %s: %v", id, err)
+			continue
+		}
+		if !mod.Equal(m.mods[i]) {
+			ssl, notAfter, err := BuildSSL(id, spec)
+			if err != nil {
+				log.Printf("[APISIX-AGENT] ERROR: %v", err)
+				continue
+			}
+			if err := m.client.RegisterSSL(ctx, ssl); err != nil {
+				log.Printf("[APISIX-AGENT] RegisterSSL failed: %v", resourceError("ssl", id, err))
+				continue
+			}
+			if m.mods[i].IsZero() {
+				log.Printf("[APISIX-AGENT] SSL registered: %s %v", id, ssl.SNIs)
+			} else {
+				log.Printf("[APISIX-AGENT] SSL %s certificate changed, re-registered", id)
+			}
+			m.mods[i], m.notAfter[i], m.warned[i] = mod, notAfter, time.Time{}
+		}
+		if !m.notAfter[i].IsZero() && time.Since(m.warned[i]) >= sslExpiryWarnEvery {
+			if warnExpiry(id, m.notAfter[i], m.warnBefore) {
+				m.warned[i] = time.Now()
+			}
+		}
+	}
+}
+
+// Watch 每 interval 调用一次 Sync，直到 ctx 取消
+func (m *SSLManager) Watch(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Sync(ctx)
+		}
+	}
+}
+
+// Delete 删除所有 SSL 对象
+func (m *SSLManager) Delete(ctx context.Context) {
+	for _, id := range m.ids {
+		if err := m.client.DeleteSSL(ctx, id); err != nil {
+			log.Printf("[APISIX-AGENT][Warn] DeleteSSL error: %v", resourceError("ssl", id, err))
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeTestCert 生成自签名证书与私钥文件
+func writeTestCert(t *testing.T, dir string, notAfter time.Time, dnsNames ...string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "test"},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certPath, keyPath
+}
+
+func TestBuildSSL(t *testing.T) {
+	dir := t.TempDir()
+	notAfter := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	certPath, keyPath := writeTestCert(t, dir, notAfter, "api.example.com", "*.example.com")
+	caPath := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caPath, []byte("CA"), 0o600)
+
+	ssl, expires, err := BuildSSL("auth-ssl-0", SSLSpec{CertFile: certPath, KeyFile: keyPath, ClientCAFile: caPath, ClientDepth: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ssl.SNIs) != 2 || ssl.SNIs[0] != "api.example.com" {
+		t.Errorf("expected snis from certificate, got %v", ssl.SNIs)
+	}
+	if ssl.Client == nil || ssl.Client.CA != "CA" || ssl.Client.Depth != 2 {
+		t.Errorf("unexpected client: %+v", ssl.Client)
+	}
+	if !expires.Equal(notAfter) {
+		t.Errorf("expected notAfter %v, got %v", notAfter, expires)
+	}
+
+	// 证书与私钥不匹配
+	_, otherKey := writeTestCert(t, t.TempDir(), notAfter, "other.example.com")
+	if _, _, err := BuildSSL("bad", SSLSpec{CertFile: certPath, KeyFile: otherKey}); err == nil {
+		t.Error("expected error for mismatched key")
+	}
+}
+
+func TestSSLManager_SyncAndDelete(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	var lastSSL SSL
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == "PUT" {
+			json.NewDecoder(r.Body).Decode(&lastSSL)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCert(t, dir, time.Now().Add(time.Hour), "api.example.com")
+	cfg := &Config{AdminAPI: srv.URL, SSLs: []SSLSpec{{CertFile: certPath, KeyFile: keyPath, SNIs: []string{"api.example.com"}}}}
+	m := NewSSLManager(NewApisixClient(cfg), cfg, "auth")
+	ctx := context.Background()
+
+	m.Sync(ctx)
+	m.Sync(ctx) // 文件未变化，不重复写入
+	if len(requests) != 1 || requests[0] != "PUT /ssls/auth-ssl-0" {
+		t.Fatalf("expected single PUT, got %v", requests)
+	}
+	oldCert := lastSSL.Cert
+
+	// 证书轮换后重新注册
+	writeTestCert(t, dir, time.Now().Add(2*time.Hour), "api.example.com")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certPath, future, future)
+	m.Sync(ctx)
+	if len(requests) != 2 || lastSSL.Cert == oldCert {
+		t.Errorf("expected re-registration with new cert, got %v", requests)
+	}
+
+	m.Delete(ctx)
+	if requests[len(requests)-1] != "DELETE /ssls/auth-ssl-0" {
+		t.Errorf("expected DELETE, got %v", requests)
+	}
+}
+
+func TestRunContext_SSLRemovedOnShutdown(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, time.Now().Add(365*24*time.Hour), "auth.example.com")
+	path := filepath.Join(dir, "apisix.yaml")
+	cfg := &Config{
+		Backend:          "standalone",
+		Standalone:       &StandaloneSpec{Path: path},
+		ServiceID:        "auth",
+		ServicePort:      8082,
+		MaxRetry:         1,
+		Upstream:         &UpstreamSpec{Nodes: map[string]int{"10.0.0.1:8082": 1}},
+		SSLs:             []SSLSpec{{CertFile: certFile, KeyFile: keyFile}},
+		SSLCheckInterval: time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- RunContext(ctx, cfg) }()
+
+	client := NewApisixClient(cfg)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if ssls, err := client.ListSSLs(context.Background(), nil); err == nil && len(ssls) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("ssl not registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// 证书持续变化，Watch 不断重新注册；退出时必须先停止 Watch 再删除
+	for i := 0; i < 5; i++ {
+		writeTestCert(t, dir, time.Now().Add(365*24*time.Hour), "auth.example.com")
+		time.Sleep(2 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if ssls, err := client.ListSSLs(context.Background(), nil); err != nil || len(ssls) != 0 {
+		t.Errorf("expected ssl deleted on shutdown, got %d err=%v", len(ssls), err)
+	}
+	if _, err := client.GetService(context.Background(), "auth"); !IsNotFound(err) {
+		t.Errorf("expected service deleted on shutdown, got %v", err)
+	}
+}
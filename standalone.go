@@ -0,0 +1,197 @@
+package apisixregistryagent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// standaloneEndMarker APISIX standalone 模式要求 apisix.yaml 以 #END 结尾，否则不会加载
+const standaloneEndMarker = "#END"
+
+const (
+	standaloneLockWait  = 10 * time.Second
+	standaloneLockStale = 30 * time.Second
+)
+
+// StandaloneBackend 将资源写入 APISIX standalone 模式（yaml config provider）的 apisix.yaml。
+// 每次写入都重新读取文件，只替换或删除同 ID 的条目，保留其他服务写入的内容，
+// 通过锁文件串行化多个 agent 的写入，并以临时文件 + rename 原子替换
+type StandaloneBackend struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func NewStandaloneBackend(spec *StandaloneSpec) (*StandaloneBackend, error) {
+	if spec == nil || spec.Path == "" {
+		return nil, fmt.Errorf("standalone backend: path is required")
+	}
+	return &StandaloneBackend{Path: spec.Path}, nil
+}
+
+func (b *StandaloneBackend) Request(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	resource, id, ok := parseResourcePath(path)
+	if !ok {
+		return nil, unsupportedPath("standalone", method, path)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if method != "GET" {
+		unlock, err := b.lock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	doc, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+	items, _ := doc[resource].([]interface{})
+	idx := -1
+	var current map[string]interface{}
+	for i, item := range items {
+		if m, ok := item.(map[string]interface{}); ok && fmt.Sprint(m[resourceKeyField(resource)]) == id {
+			idx, current = i, m
+			break
+		}
+	}
+
+	switch method {
+	case "GET":
+		if id == "" {
+			values := make([]map[string]interface{}, 0, len(items))
+			for _, item := range items {
+				if m, ok := item.(map[string]interface{}); ok {
+					values = append(values, m)
+				}
+			}
+			return listResponse(path, "", resource, values)
+		}
+		if current == nil {
+			return nil, backendError(method, path, http.StatusNotFound, "Key not found")
+		}
+		return itemResponse("", resource, id, current)
+	case "DELETE":
+		if current == nil {
+			return nil, backendError(method, path, http.StatusNotFound, "Key not found")
+		}
+		items = append(items[:idx:idx], items[idx+1:]...)
+	default:
+		value, err := applyWrite(method, path, resource, id, current, body)
+		if err != nil {
+			return nil, err
+		}
+		if idx >= 0 {
+			items[idx] = value
+		} else {
+			items = append(items, value)
+		}
+	}
+	if len(items) == 0 {
+		delete(doc, resource)
+	} else {
+		doc[resource] = items
+	}
+	if err := b.save(doc); err != nil {
+		return nil, err
+	}
+	return []byte(`{}`), nil
+}
+
+// load 读取 apisix.yaml，文件不存在时返回空文档；未识别的顶层段原样保留
+func (b *StandaloneBackend) load() (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	data, err := os.ReadFile(b.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return doc, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", b.Path, err)
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", b.Path, err)
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	return doc, nil
+}
+
+// save 渲染 apisix.yaml（追加 #END）并原子替换目标文件
+func (b *StandaloneBackend) save(doc map[string]interface{}) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if len(doc) > 0 {
+		if err := enc.Encode(doc); err != nil {
+			return fmt.Errorf("render %s: %w", b.Path, err)
+		}
+	}
+	enc.Close()
+	buf.WriteString(standaloneEndMarker + "\n")
+
+	tmp, err := os.CreateTemp(filepath.Dir(b.Path), "."+filepath.Base(b.Path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("write %s: %w", b.Path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write %s: %w", b.Path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write %s: %w", b.Path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write %s: %w", b.Path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", b.Path, err)
+	}
+	if err := os.Rename(tmp.Name(), b.Path); err != nil {
+		return fmt.Errorf("write %s: %w", b.Path, err)
+	}
+	return nil
+}
+
+// lock 通过 O_EXCL 创建锁文件串行化多个 agent 的读-改-写，超过 standaloneLockStale 的锁视为残留
+func (b *StandaloneBackend) lock(ctx context.Context) (func(), error) {
+	lockPath := b.Path + ".lock"
+	deadline := time.Now().Add(standaloneLockWait)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("lock %s: %w", b.Path, err)
+		}
+		if fi, err := os.Stat(lockPath); err == nil && time.Since(fi.ModTime()) > standaloneLockStale {
+			log.Printf("[APISIX-AGENT][Warn] Removing stale lock %s", lockPath)
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("lock %s: timed out after %v", b.Path, standaloneLockWait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestStandaloneBackend(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "apisix.yaml")
+	existing := `routes:
+  - id: billing-0
+    uri: /billing
+    upstream_id: billing
+deployment_note: keep me
+#END
+`
+	if err := os.WriteFile(path, []byte(existing), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	client := NewApisixClient(&Config{Backend: "standalone", Standalone: &StandaloneSpec{Path: path}})
+	ctx := context.Background()
+	if err := client.EnsureVersion(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.RegisterUpstream(ctx, &Upstream{ID: "auth", Type: "roundrobin", Nodes: map[string]int{"10.0.0.1:8082": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewService("auth", "auth", "auth").WithPlugin("traffic-split", map[string]interface{}{"rules": []interface{}{}})
+	if err := client.RegisterService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RegisterRoute(ctx, NewRoute("auth-0", "auth", "/v1/login")); err != nil {
+		t.Fatal(err)
+	}
+	// 重复写入替换同 ID 条目
+	if err := client.RegisterRoute(ctx, NewRoute("auth-0", "auth", "/v1/signin")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PatchService(ctx, "auth", map[string]interface{}{"plugins": map[string]interface{}{"traffic-split": nil}}); err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := client.ListRoutes(ctx, nil)
+	if err != nil || len(routes) != 2 || routes[1].URI != "/v1/signin" {
+		t.Fatalf("expected billing and auth routes, got %+v err=%v", routes, err)
+	}
+	got, err := client.GetService(ctx, "auth")
+	if err != nil || got.Plugins["traffic-split"] != nil {
+		t.Errorf("expected traffic-split removed by patch, got %+v err=%v", got, err)
+	}
+	if _, err := client.GetRoute(ctx, "missing"); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	if err := client.DeleteRoute(ctx, "auth-0"); err != nil {
+		t.Fatal(err)
+	}
+	// 与 Admin API 一致，删除不存在的资源视为成功
+	if err := client.DeleteRoute(ctx, "auth-0"); err != nil {
+		t.Errorf("expected deleting a missing route to succeed, got %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasSuffix(string(data), "#END\n") {
+		t.Errorf("expected #END marker, got:\n%s", data)
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["deployment_note"] != "keep me" || len(doc["routes"].([]interface{})) != 1 || len(doc["upstreams"].([]interface{})) != 1 {
+		t.Errorf("expected other sections preserved, got:\n%s", data)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected no temp or lock files left, got %d entries", len(entries))
+	}
+}
+
+func TestStandaloneBackend_ListPagination(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apisix.yaml")
+	var buf strings.Builder
+	buf.WriteString("routes:\n")
+	for i := 0; i < maxPageSize+1; i++ {
+		fmt.Fprintf(&buf, "  - id: r%d\n    uri: /r%d\n", i, i)
+	}
+	buf.WriteString("#END\n")
+	os.WriteFile(path, []byte(buf.String()), 0o644)
+	client := NewApisixClient(&Config{Backend: "standalone", Standalone: &StandaloneSpec{Path: path}})
+
+	routes, err := client.ListRoutes(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, r := range routes {
+		if seen[r.ID] {
+			t.Fatalf("duplicate route %s across pages", r.ID)
+		}
+		seen[r.ID] = true
+	}
+	if len(routes) != maxPageSize+1 {
+		t.Errorf("expected %d routes, got %d", maxPageSize+1, len(routes))
+	}
+}
+
+func TestInvalidBackendConfig(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+	defer srv.Close()
+	for _, cfg := range []*Config{
+		{AdminAPI: srv.URL, Backend: "standalone"},
+		{AdminAPI: srv.URL, Backend: "etcd"},
+		{AdminAPI: srv.URL, Backend: "zookeeper"},
+	} {
+		if err := RunContext(context.Background(), cfg); err == nil {
+			t.Errorf("backend %q: expected startup error", cfg.Backend)
+		}
+		client := NewApisixClient(cfg)
+		if err := client.DeleteRoute(context.Background(), "r1"); err == nil {
+			t.Errorf("backend %q: expected request error", cfg.Backend)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("expected no fallback to the Admin API, got %d requests", calls)
+	}
+}
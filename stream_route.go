@@ -0,0 +1,59 @@
+package apisixregistryagent
+
+import (
+	"fmt"
+)
+
+// streamRouteID 返回四层路由 ID
+func streamRouteID(serviceID string, i int, spec StreamRouteSpec) string {
+	if spec.ID != "" {
+		return spec.ID
+	}
+	return fmt.Sprintf("%s-stream-%d", serviceID, i)
+}
+
+// buildStreamRoute 生成四层路由；未配置 upstream 时引用服务的 upstreamID
+func buildStreamRoute(id, upstreamID string, spec StreamRouteSpec) (*StreamRoute, error) {
+	if spec.ServerPort < 0 || spec.ServerPort > 65535 {
+		return nil, fmt.Errorf("stream route %s: invalid server_port %d", id, spec.ServerPort)
+	}
+	route := &StreamRoute{
+		ID:         id,
+		Desc:       "Auto registered by apisix-registry-agent",
+		ServerAddr: spec.ServerAddr,
+		ServerPort: spec.ServerPort,
+		RemoteAddr: spec.RemoteAddr,
+		SNI:        spec.SNI,
+	}
+	if up := spec.Upstream; up != nil {
+		scheme := up.Scheme
+		if scheme == "" {
+			scheme = "tcp"
+		}
+		switch scheme {
+		case "tcp", "udp", "tls":
+		default:
+			return nil, fmt.Errorf("stream route %s: unsupported upstream scheme %s", id, scheme)
+		}
+		if len(up.Nodes) == 0 {
+			return nil, fmt.Errorf("stream route %s: upstream nodes are required", id)
+		}
+		typ := up.Type
+		if typ == "" {
+			typ = "roundrobin"
+		}
+		route.Upstream = &Upstream{Type: typ, Scheme: scheme, Nodes: up.Nodes}
+	} else {
+		if upstreamID == "" {
+			return nil, fmt.Errorf("stream route %s: upstream is required", id)
+		}
+		route.UpstreamID = upstreamID
+	}
+	for _, p := range spec.Plugins {
+		if route.Plugins == nil {
+			route.Plugins = map[string]interface{}{}
+		}
+		route.Plugins[p.Name] = copyPluginConfig(p.Config)
+	}
+	return route, nil
+}
@@ -0,0 +1,35 @@
+package apisixregistryagent
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildStreamRoute(t *testing.T) {
+	spec := StreamRouteSpec{
+		ServerPort: 6379,
+		RemoteAddr: "10.0.0.0/8",
+		Upstream:   &StreamUpstreamSpec{Nodes: map[string]int{"redis:6379": 1}},
+	}
+	route, err := buildStreamRoute(streamRouteID("cache", 0, spec), "cache", spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := json.Marshal(route)
+	want := `{"id":"cache-stream-0","desc":"Auto registered by apisix-registry-agent","server_port":6379,"remote_addr":"10.0.0.0/8","upstream":{"type":"roundrobin","scheme":"tcp","nodes":{"redis:6379":1}}}`
+	if string(data) != want {
+		t.Errorf("unexpected stream route json:\n got: %s\nwant: %s", data, want)
+	}
+
+	// 未配置 upstream 时引用服务的 upstream
+	mqtt := StreamRouteSpec{ID: "mqtt", ServerPort: 1883, SNI: "mqtt.example.com"}
+	route, err = buildStreamRoute(streamRouteID("iot", 1, mqtt), "iot", mqtt)
+	if err != nil || route.ID != "mqtt" || route.UpstreamID != "iot" || route.Upstream != nil {
+		t.Errorf("expected upstream_id reference, got %+v err=%v", route, err)
+	}
+
+	spec.Upstream.Scheme = "grpc"
+	if _, err := buildStreamRoute("bad", "cache", spec); err == nil {
+		t.Error("expected error for non-L4 upstream scheme")
+	}
+}
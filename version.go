@@ -0,0 +1,142 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GatewayVersion APISIX 网关版本
+type GatewayVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func (v GatewayVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast 判断版本是否不低于 major.minor
+func (v GatewayVersion) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// ParseGatewayVersion 解析 "3.8.0"、"v2.15"、"APISIX/3.9.1" 等格式
+func ParseGatewayVersion(s string) (GatewayVersion, error) {
+	raw := s
+	s = strings.TrimPrefix(strings.TrimSpace(s), "APISIX/")
+	s = strings.TrimPrefix(s, "v")
+	var v GatewayVersion
+	parts := strings.SplitN(s, ".", 3)
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		// 去掉 "3.8.0-rc1" 之类的后缀
+		if idx := strings.IndexFunc(p, func(r rune) bool { return r < '0' || r > '9' }); idx >= 0 {
+			p = p[:idx]
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return GatewayVersion{}, fmt.Errorf("invalid APISIX version %q", raw)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+// ErrUnsupportedVersion 网关版本不受支持
+var ErrUnsupportedVersion = errors.New("unsupported APISIX version")
+
+// checkSupported 仅支持 APISIX 2.x 与 3.x
+func checkSupported(v GatewayVersion) error {
+	if v.Major < 2 || v.Major > 3 {
+		return fmt.Errorf("%w %s: apisix-registry-agent supports APISIX 2.x and 3.x", ErrUnsupportedVersion, v)
+	}
+	return nil
+}
+
+// versionProbePath 探测请求只取一页（APISIX v3 的 page_size 最小为 10），避免路由较多时拉取完整列表；
+// v2 不支持分页，忽略这两个参数
+const versionProbePath = "/routes?page=1&page_size=10"
+
+// DetectVersion 探测网关版本：优先使用 Admin API 响应的 Server 头（APISIX/x.y.z），
+// 没有时根据列表响应格式推断主版本（v3 为 list，v2 为 node.nodes）
+func (c *ApisixClient) DetectVersion(ctx context.Context) (GatewayVersion, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.AdminAPI+versionProbePath, nil)
+	if err != nil {
+		return GatewayVersion{}, err
+	}
+	req.Header.Set("X-API-KEY", c.adminKey(ctx, false))
+	release, err := c.Breaker.acquire()
+	if err != nil {
+		return GatewayVersion{}, fmt.Errorf("detect APISIX version: %w", err)
+	}
+	defer release()
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		// ctx 取消不代表网关不可用
+		if ctx.Err() == nil {
+			c.Breaker.Failure()
+		}
+		return GatewayVersion{}, fmt.Errorf("detect APISIX version: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		c.Breaker.Failure()
+	} else {
+		c.Breaker.Success()
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if server := resp.Header.Get("Server"); strings.HasPrefix(server, "APISIX/") {
+		return ParseGatewayVersion(server)
+	}
+	if resp.StatusCode >= 300 {
+		return GatewayVersion{}, fmt.Errorf("detect APISIX version: status=%d, resp=%s", resp.StatusCode, string(body))
+	}
+	var shape struct {
+		List json.RawMessage `json:"list"`
+		Node json.RawMessage `json:"node"`
+	}
+	if json.Unmarshal(body, &shape) == nil {
+		if len(shape.List) > 0 {
+			return GatewayVersion{Major: 3}, nil
+		}
+		if len(shape.Node) > 0 {
+			return GatewayVersion{Major: 2}, nil
+		}
+	}
+	return GatewayVersion{}, fmt.Errorf("detect APISIX version: unrecognized Admin API response")
+}
+
+// EnsureVersion 确定网关版本（已配置时直接校验），不支持的版本返回错误以便尽早失败
+func (c *ApisixClient) EnsureVersion(ctx context.Context) error {
+	// 非 Admin API 后端无法探测，未配置 apisix_version 时按 3.x 处理
+	if c.Version == nil && c.Backend != nil {
+		c.Version = &GatewayVersion{Major: 3}
+	}
+	if c.Version == nil {
+		v, err := c.DetectVersion(ctx)
+		if err != nil {
+			return err
+		}
+		c.Version = &v
+		log.Printf("[APISIX-AGENT] Detected APISIX version: %s", v)
+	}
+	return checkSupported(*c.Version)
+}
+
+// isV2 未探测到版本时按 v3 处理
+func (c *ApisixClient) isV2() bool {
+	return c.Version != nil && c.Version.Major == 2
+}
+
+// supportsCredentials APISIX 3.10 起 consumer 鉴权信息可作为独立的 credentials 资源
+func (c *ApisixClient) supportsCredentials() bool {
+	return c.Version != nil && c.Version.AtLeast(3, 10)
+}
@@ -0,0 +1,79 @@
+package apisixregistryagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseGatewayVersion(t *testing.T) {
+	for in, want := range map[string]GatewayVersion{
+		"3.8.0":        {3, 8, 0},
+		"APISIX/3.9.1": {3, 9, 1},
+		"v2.15":        {2, 15, 0},
+		"3.10.0-rc1":   {3, 10, 0},
+	} {
+		got, err := ParseGatewayVersion(in)
+		if err != nil || got != want {
+			t.Errorf("ParseGatewayVersion(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseGatewayVersion("latest"); err == nil {
+		t.Errorf("expected error for invalid version")
+	}
+}
+
+func TestApisixClient_EnsureVersion(t *testing.T) {
+	var server, body, probe string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probe = r.URL.RequestURI()
+		if server != "" {
+			w.Header().Set("Server", server)
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+	cfg := &Config{AdminAPI: srv.URL, MaxRetry: 1, RetryInterval: time.Millisecond}
+
+	server, body = "APISIX/3.11.0", `{"total":0,"list":[]}`
+	client := NewApisixClient(cfg)
+	if err := client.EnsureVersion(context.Background()); err != nil || client.Version.Minor != 11 || !client.supportsCredentials() {
+		t.Errorf("unexpected version from Server header: %v, err=%v", client.Version, err)
+	}
+	// 探测只请求一页路由
+	if probe != "/routes?page=1&page_size=10" {
+		t.Errorf("expected a single-page probe, got %s", probe)
+	}
+
+	server, body = "", `{"action":"get","node":{"dir":true,"nodes":[]}}`
+	client = NewApisixClient(cfg)
+	if err := client.EnsureVersion(context.Background()); err != nil || !client.isV2() {
+		t.Errorf("expected v2 from response shape: %v, err=%v", client.Version, err)
+	}
+
+	server = "APISIX/1.5.0"
+	client = NewApisixClient(cfg)
+	if err := client.EnsureVersion(context.Background()); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected unsupported version error, got %v", err)
+	}
+}
+
+func TestApisixClient_RegisterConsumerCredentials(t *testing.T) {
+	paths := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths[r.URL.Path] = true
+	}))
+	defer srv.Close()
+	client := NewApisixClient(&Config{AdminAPI: srv.URL, MaxRetry: 1, RetryInterval: time.Millisecond, ApisixVersion: "3.10"})
+	consumer := NewConsumer("auth").WithPlugin("key-auth", map[string]interface{}{"key": "k"})
+	if err := client.RegisterConsumer(context.Background(), consumer); err != nil {
+		t.Fatalf("RegisterConsumer error: %v", err)
+	}
+	if !paths["/consumers/auth"] || !paths["/consumers/auth/credentials/auth-key-auth"] {
+		t.Errorf("expected consumer and credential writes, got %v", paths)
+	}
+}